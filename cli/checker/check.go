@@ -4,8 +4,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -50,6 +55,66 @@ func (c GenericChecker) CheckURL(ctx context.Context, u string) bool {
 	return resp.StatusCode == 200
 }
 
+// get returns the status code and the body of the response to a GET request to the given path.
+func (c GenericChecker) get(ctx context.Context, u string, header http.Header) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+u, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// StatusError is returned when an API answers with an unexpected status code.
+type StatusError struct {
+	Path string
+	Code int
+	Body string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Path, e.Code, e.Body)
+}
+
+// Denied tells whether the request was rejected for a missing or insufficient token.
+func (e StatusError) Denied() bool {
+	return e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden
+}
+
+// getJSON decodes the response to a GET request to the given path, sending the token in the
+// given header when set.
+func (c GenericChecker) getJSON(ctx context.Context, u, tokenHeader, token string, v interface{}) error {
+	var header http.Header
+	if token != "" {
+		header = http.Header{tokenHeader: []string{token}}
+	}
+	code, body, err := c.get(ctx, u, header)
+	if err != nil {
+		return err
+	}
+	if code != http.StatusOK {
+		return StatusError{Path: u, Code: code, Body: strings.TrimSpace(string(body))}
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unable to decode %s: %w", u, err)
+	}
+	return nil
+}
+
+// ClientTimeout bounds each request of the checkers, in addition to the deadline of its context.
+const ClientTimeout = 30 * time.Second
+
 func TLSClient(ca string) (func(*GenericChecker), error) {
 	if _, err := os.ReadFile(ca); err != nil {
 		return nil, err
@@ -66,6 +131,6 @@ func TLSClient(ca string) (func(*GenericChecker), error) {
 		}
 		transport := &http.Transport{TLSClientConfig: tlsConfig}
 
-		gc.Client = &http.Client{Transport: transport}
+		gc.Client = &http.Client{Transport: transport, Timeout: ClientTimeout}
 	}, nil
 }
@@ -2,16 +2,65 @@ package checker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type ConsulChecker struct {
 	GenericChecker
+	// Token is sent as X-Consul-Token, as the agent and operator endpoints require it when the ACLs are enabled.
+	Token string
+}
+
+// ConsulDetails describes the Consul cluster.
+type ConsulDetails struct {
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Datacenter string `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+	Leader     string `json:"leader,omitempty" yaml:"leader,omitempty"`
+	// Peers is the number of servers in the raft configuration, Voters the ones taking part in the elections.
+	Peers  int `json:"peers" yaml:"peers"`
+	Voters int `json:"voters" yaml:"voters"`
+	// AutopilotHealthy is nil when the autopilot health could not be read.
+	AutopilotHealthy *bool `json:"autopilotHealthy,omitempty" yaml:"autopilotHealthy,omitempty"`
+	FailureTolerance int   `json:"failureTolerance" yaml:"failureTolerance"`
+	// ConnectCARoots is the number of Connect CA roots, ConnectCAActive tells whether one of them is active.
+	ConnectCARoots  int  `json:"connectCARoots" yaml:"connectCARoots"`
+	ConnectCAActive bool `json:"connectCAActive" yaml:"connectCAActive"`
+}
+
+type consulAgentSelf struct {
+	Config struct {
+		Datacenter string
+		Version    string
+	}
+}
+
+type consulRaftConfiguration struct {
+	Servers []struct {
+		Node    string
+		Address string
+		Leader  bool
+		Voter   bool
+	}
+}
+
+type consulAutopilotHealth struct {
+	Healthy          bool
+	FailureTolerance int
+}
+
+type consulCARoots struct {
+	ActiveRootID string
+	Roots        []struct {
+		ID     string
+		Active bool
+	}
 }
 
 func NewConsulChecker(u, ca string, options ...func(*GenericChecker)) (cc ConsulChecker, err error) {
@@ -35,30 +84,123 @@ func (cc ConsulChecker) Status(ctx context.Context) bool {
 	return cc.GenericChecker.CheckURL(ctx, u)
 }
 
+// Health checks that the Consul servers elected a leader.
+func (cc ConsulChecker) Health(ctx context.Context) (h HealthResult) {
+	start := time.Now()
+	leader := ""
+	err := cc.getJSON(ctx, "/v1/status/leader", &leader)
+	h.Latency = time.Since(start)
+	switch {
+	case err != nil:
+		h.State, h.Reason = Unreachable, err.Error()
+	case leader == "":
+		h.State, h.Reason = Unhealthy, "no leader elected"
+	default:
+		h.State, h.Leader = Healthy, leader
+	}
+	return h
+}
+
 func (cc ConsulChecker) Version(ctx context.Context) (version string) {
+	self, err := cc.agentSelf(ctx)
+	if err != nil {
+		log.Error().Msgf("error reading consul agent: %s", err)
+		return fmt.Sprintf("error: %s\n", err)
+	}
+	return self.Config.Version
+}
+
+// Details reads the version, the raft configuration, the autopilot health and the Connect CA of the
+// cluster. The details that could be read are returned together with the first error.
+func (cc ConsulChecker) Details(ctx context.Context) (d ConsulDetails, err error) {
+	keep := func(e error) {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	self, e := cc.agentSelf(ctx)
+	keep(e)
+	d.Version, d.Datacenter = self.Config.Version, self.Config.Datacenter
+	keep(cc.getJSON(ctx, "/v1/status/leader", &d.Leader))
+
+	raft := consulRaftConfiguration{}
+	if e := cc.getJSON(ctx, "/v1/operator/raft/configuration", &raft); e == nil {
+		d.Peers = len(raft.Servers)
+		for _, s := range raft.Servers {
+			if s.Voter {
+				d.Voters++
+			}
+		}
+	} else {
+		keep(e)
+	}
+
+	// autopilot answers 429 when the cluster is not healthy, with the same body
+	ap := consulAutopilotHealth{}
+	e = cc.getJSON(ctx, "/v1/operator/autopilot/health", &ap)
+	if se := (StatusError{}); errors.As(e, &se) && se.Code == http.StatusTooManyRequests {
+		ap.Healthy, e = false, nil
+	}
+	if e == nil {
+		d.AutopilotHealthy, d.FailureTolerance = &ap.Healthy, ap.FailureTolerance
+	} else {
+		keep(e)
+	}
+
+	roots := consulCARoots{}
+	if e := cc.getJSON(ctx, "/v1/connect/ca/roots", &roots); e == nil {
+		d.ConnectCARoots = len(roots.Roots)
+		for _, r := range roots.Roots {
+			if r.Active && r.ID == roots.ActiveRootID {
+				d.ConnectCAActive = true
+			}
+		}
+	} else {
+		keep(e)
+	}
+	return d, err
+}
+
+// agentSelf reads the agent configuration. When the API denies the request, as it happens without
+// a token, the version is scraped from the UI instead.
+func (cc ConsulChecker) agentSelf(ctx context.Context) (self consulAgentSelf, err error) {
+	err = cc.getJSON(ctx, "/v1/agent/self", &self)
+	if se := (StatusError{}); errors.As(err, &se) && se.Denied() {
+		log.Debug().Msgf("consul agent API denied, reading the version from the UI: %s", err)
+		self.Config.Datacenter = cc.Datacenter
+		self.Config.Version, err = cc.scrapeVersion(ctx)
+	}
+	return self, err
+}
+
+// scrapeVersion reads the version from the HTML of the UI.
+func (cc ConsulChecker) scrapeVersion(ctx context.Context) (string, error) {
 	u := "/ui/" + cc.Datacenter + "/services"
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cc.url+u, nil)
 	if err != nil {
-		log.Error().Msgf("error creating request: %s", err)
-		return fmt.Sprintf("error: %s\n", err)
+		return "", err
 	}
 	resp, err := cc.Client.Do(req)
 	if err != nil {
-		log.Error().Msgf("error executing request: %s", err)
-		return fmt.Sprintf("error: %s\n", err)
+		return "", err
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Debug().Msgf("body: %s error: %s", body, err)
-		log.Error().Msgf("error reading response: %s", err)
-		return ""
+		return "", err
 	}
 
 	re := regexp.MustCompile("CONSUL_VERSION: (.*) --")
 	match := re.FindStringSubmatch(string(body))
 	if len(match) == 2 {
-		return match[1]
+		return match[1], nil
 	}
-	return "not found"
+	return "not found", nil
+}
+
+// getJSON decodes the response to a GET request to the given path of the Consul API.
+func (cc ConsulChecker) getJSON(ctx context.Context, u string, v interface{}) error {
+	return cc.GenericChecker.getJSON(ctx, u, "X-Consul-Token", cc.Token, v)
 }
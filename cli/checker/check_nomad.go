@@ -2,10 +2,54 @@ package checker
 
 import (
 	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 type NomadChecker struct {
 	GenericChecker
+	// Token is sent as X-Nomad-Token, as the agent and nodes endpoints require it when the ACLs are enabled.
+	Token string
+}
+
+// NomadDetails describes the Nomad cluster.
+type NomadDetails struct {
+	Version    string `json:"version,omitempty" yaml:"version,omitempty"`
+	Region     string `json:"region,omitempty" yaml:"region,omitempty"`
+	Datacenter string `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+	Leader     string `json:"leader,omitempty" yaml:"leader,omitempty"`
+	// Servers is the number of alive servers, Peers the number of servers in the raft configuration.
+	Servers    int `json:"servers" yaml:"servers"`
+	Peers      int `json:"peers" yaml:"peers"`
+	ReadyNodes int `json:"readyNodes" yaml:"readyNodes"`
+	Nodes      int `json:"nodes" yaml:"nodes"`
+}
+
+type nomadAgentSelf struct {
+	Config struct {
+		Region     string
+		Datacenter string
+		Version    struct {
+			Version           string
+			VersionPrerelease string
+		}
+	} `json:"config"`
+	Member struct {
+		Tags map[string]string
+	} `json:"member"`
+}
+
+type nomadMembers struct {
+	Members []struct {
+		Name   string
+		Status string
+	}
+}
+
+type nomadNode struct {
+	Status string
 }
 
 func NewNomadChecker(u, ca string, options ...func(*GenericChecker)) (nc NomadChecker, err error) {
@@ -29,7 +73,93 @@ func (n NomadChecker) Status(ctx context.Context) bool {
 	return n.GenericChecker.CheckURL(ctx, u)
 }
 
+// Health checks that the Nomad servers elected a leader.
+func (n NomadChecker) Health(ctx context.Context) (h HealthResult) {
+	start := time.Now()
+	leader := ""
+	err := n.getJSON(ctx, "/v1/status/leader", &leader)
+	h.Latency = time.Since(start)
+	switch {
+	case err != nil:
+		h.State, h.Reason = Unreachable, err.Error()
+	case leader == "":
+		h.State, h.Reason = Unhealthy, "no leader elected"
+	default:
+		h.State, h.Leader = Healthy, leader
+	}
+	return h
+}
+
 func (n NomadChecker) Version(ctx context.Context) string {
-	// TODO find endpoint
-	return "missing endpoint"
+	self := nomadAgentSelf{}
+	if err := n.getJSON(ctx, "/v1/agent/self", &self); err != nil {
+		log.Error().Msgf("error reading nomad agent: %s", err)
+		return fmt.Sprintf("error: %s\n", err)
+	}
+	return self.version()
+}
+
+// Details reads the version, the servers and the client nodes of the cluster. The details that could
+// be read are returned together with the first error.
+func (n NomadChecker) Details(ctx context.Context) (d NomadDetails, err error) {
+	keep := func(e error) {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	self := nomadAgentSelf{}
+	if e := n.getJSON(ctx, "/v1/agent/self", &self); e == nil {
+		d.Version, d.Region, d.Datacenter = self.version(), self.Config.Region, self.Config.Datacenter
+	} else {
+		keep(e)
+	}
+	keep(n.getJSON(ctx, "/v1/status/leader", &d.Leader))
+
+	members := nomadMembers{}
+	if e := n.getJSON(ctx, "/v1/agent/members", &members); e == nil {
+		for _, m := range members.Members {
+			if m.Status == "alive" {
+				d.Servers++
+			}
+		}
+	} else {
+		keep(e)
+	}
+
+	peers := []string{}
+	if e := n.getJSON(ctx, "/v1/status/peers", &peers); e == nil {
+		d.Peers = len(peers)
+	} else {
+		keep(e)
+	}
+
+	nodes := []nomadNode{}
+	if e := n.getJSON(ctx, "/v1/nodes", &nodes); e == nil {
+		d.Nodes = len(nodes)
+		for _, node := range nodes {
+			if node.Status == "ready" {
+				d.ReadyNodes++
+			}
+		}
+	} else {
+		keep(e)
+	}
+	return d, err
+}
+
+// getJSON decodes the response to a GET request to the given path of the Nomad API.
+func (n NomadChecker) getJSON(ctx context.Context, u string, v interface{}) error {
+	return n.GenericChecker.getJSON(ctx, u, "X-Nomad-Token", n.Token, v)
+}
+
+func (s nomadAgentSelf) version() string {
+	v := s.Config.Version.Version
+	if v == "" {
+		return s.Member.Tags["build"]
+	}
+	if s.Config.Version.VersionPrerelease != "" {
+		v += "-" + s.Config.Version.VersionPrerelease
+	}
+	return v
 }
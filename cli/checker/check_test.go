@@ -50,10 +50,10 @@ func TestCheck(t *testing.T) {
 	}
 
 	tests := []test{
-		{name: "nomad", statusCode: 200, status: true, version: "missing endpoint", body: ""},
-		{name: "nomad", statusCode: 400, status: false, version: "missing endpoint", body: ""},
-		{name: "consul", statusCode: 200, status: true, version: "1.2.3", body: "blah blah CONSUL_VERSION: 1.2.3 --- zzzz"},
-		{name: "consul", statusCode: 500, status: false, version: "1.2.3", body: "blah blah CONSUL_VERSION: 1.2.3 --- zzzz"},
+		{name: "nomad", statusCode: 200, status: true, version: "1.5.6", body: `{"config": {"Version": {"Version": "1.5.6"}}}`},
+		{name: "nomad", statusCode: 400, status: false, version: "error: /v1/agent/self returned 400: forbidden\n", body: "forbidden"},
+		{name: "consul", statusCode: 200, status: true, version: "1.2.3", body: `{"Config": {"Datacenter": "dc1", "Version": "1.2.3"}}`},
+		{name: "consul", statusCode: 500, status: false, version: "error: /v1/agent/self returned 500: internal error\n", body: "internal error"},
 		{name: "vault", statusCode: 200, status: true, version: "1.2.4", body: `{ "Version": "1.2.4" }`},
 		{name: "vault", statusCode: 500, status: false, version: "1.2.4", body: `{ "Version": "1.2.4" }`},
 	}
@@ -91,3 +91,135 @@ func TestCheck(t *testing.T) {
 		})
 	}
 }
+
+func TestVaultHealth(t *testing.T) {
+	ctx := context.Background()
+
+	type test struct {
+		desc       string
+		statusCode int
+		body       string
+		state      checker.HealthState
+		ready      bool
+		standbyOK  bool
+	}
+
+	tests := []test{
+		{desc: "active", statusCode: 200, body: `{"initialized": true, "sealed": false, "version": "1.13.2", "cluster_name": "vault-cluster"}`, state: checker.Healthy, ready: true},
+		{desc: "standby", statusCode: 429, body: `{"initialized": true, "standby": true}`, state: checker.Standby},
+		{desc: "standby ok", statusCode: 429, body: `{"initialized": true, "standby": true}`, state: checker.Standby, ready: true, standbyOK: true},
+		{desc: "performance standby", statusCode: 473, body: `{"initialized": true, "performance_standby": true}`, state: checker.PerfStandby},
+		{desc: "uninitialized", statusCode: 501, body: `{"initialized": false, "sealed": true}`, state: checker.Uninitialized},
+		{desc: "sealed", statusCode: 503, body: `{"initialized": true, "sealed": true}`, state: checker.Sealed},
+		{desc: "error", statusCode: 500, body: ``, state: checker.Unhealthy},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			client := func(ch *checker.GenericChecker) {
+				ch.Client = NewTestClient(func(req *http.Request) *http.Response {
+					if req.URL.Path == "/v1/sys/leader" {
+						return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(`{"leader_address": "https://10.0.0.1:8200"}`))}
+					}
+					return &http.Response{StatusCode: tc.statusCode, Body: io.NopCloser(strings.NewReader(tc.body))}
+				})
+			}
+			vc, _ := checker.NewVaultChecker("http://vault", "testdata/ca.empty", client)
+			vc.AcceptStandby = tc.standbyOK
+
+			h := vc.Health(ctx)
+			if h.State != tc.state {
+				t.Errorf("got state %s but wanted %s", h.State, tc.state)
+			}
+			if h.State != checker.Healthy && h.Reason == "" {
+				t.Errorf("missing reason of state %s", h.State)
+			}
+			if got := vc.Status(ctx); got != tc.ready {
+				t.Errorf("got status %t but wanted %t", got, tc.ready)
+			}
+			if tc.state == checker.Healthy && (h.Version != "1.13.2" || h.ClusterName != "vault-cluster" || h.Leader != "https://10.0.0.1:8200") {
+				t.Errorf("health details not read: %+v", h)
+			}
+		})
+	}
+}
+
+func TestNomadDetails(t *testing.T) {
+	responses := map[string]string{
+		"/v1/agent/self":    `{"config": {"Region": "global", "Datacenter": "dc1", "Version": {"Version": "1.5.6"}}, "member": {"Tags": {"build": "1.5.6"}}}`,
+		"/v1/status/leader": `"10.0.0.1:4647"`,
+		"/v1/agent/members": `{"Members": [{"Name": "s1", "Status": "alive"}, {"Name": "s2", "Status": "alive"}, {"Name": "s3", "Status": "failed"}]}`,
+		"/v1/status/peers":  `["10.0.0.1:4647", "10.0.0.2:4647", "10.0.0.3:4647"]`,
+		"/v1/nodes":         `[{"Status": "ready"}, {"Status": "ready"}, {"Status": "down"}]`,
+	}
+	client := func(ch *checker.GenericChecker) {
+		ch.Client = NewTestClient(func(req *http.Request) *http.Response {
+			if req.Header.Get("X-Nomad-Token") != "token" {
+				return &http.Response{StatusCode: 403, Body: io.NopCloser(strings.NewReader("Permission denied"))}
+			}
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(responses[req.URL.Path]))}
+		})
+	}
+	nc, _ := checker.NewNomadChecker("http://nomad", "testdata/ca.empty", client)
+
+	if _, err := nc.Details(context.Background()); err == nil {
+		t.Errorf("details read without a token")
+	}
+
+	nc.Token = "token"
+	d, err := nc.Details(context.Background())
+	if err != nil {
+		t.Fatalf("unable to read details: %s", err)
+	}
+	want := checker.NomadDetails{Version: "1.5.6", Region: "global", Datacenter: "dc1", Leader: "10.0.0.1:4647", Servers: 2, Peers: 3, ReadyNodes: 2, Nodes: 3}
+	if d != want {
+		t.Errorf("got %+v but wanted %+v", d, want)
+	}
+	if h := nc.Health(context.Background()); h.State != checker.Healthy || h.Leader != "10.0.0.1:4647" {
+		t.Errorf("unexpected health %+v", h)
+	}
+}
+
+func TestConsulDetails(t *testing.T) {
+	responses := map[string]string{
+		"/v1/agent/self":                  `{"Config": {"Datacenter": "dc1", "Version": "1.15.2"}}`,
+		"/v1/status/leader":               `"10.0.0.1:8300"`,
+		"/v1/operator/raft/configuration": `{"Servers": [{"Node": "s1", "Leader": true, "Voter": true}, {"Node": "s2", "Voter": true}, {"Node": "s3", "Voter": false}]}`,
+		"/v1/operator/autopilot/health":   `{"Healthy": false, "FailureTolerance": 0}`,
+		"/v1/connect/ca/roots":            `{"ActiveRootID": "r2", "Roots": [{"ID": "r1"}, {"ID": "r2", "Active": true}]}`,
+		"/ui/dc1/services":                "blah blah CONSUL_VERSION: 1.15.1 --- zzzz",
+	}
+	client := func(ch *checker.GenericChecker) {
+		ch.Client = NewTestClient(func(req *http.Request) *http.Response {
+			code := 200
+			switch {
+			case strings.HasPrefix(req.URL.Path, "/ui/"):
+			case req.Header.Get("X-Consul-Token") != "token" && req.URL.Path != "/v1/status/leader":
+				return &http.Response{StatusCode: 403, Body: io.NopCloser(strings.NewReader("ACL not found"))}
+			case req.URL.Path == "/v1/operator/autopilot/health":
+				code = 429
+			}
+			return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader(responses[req.URL.Path]))}
+		})
+	}
+	dc := func(ch *checker.GenericChecker) {
+		ch.Datacenter = "dc1"
+	}
+	cc, _ := checker.NewConsulChecker("http://consul", "testdata/ca.empty", client, dc)
+
+	if v := cc.Version(context.Background()); v != "1.15.1" {
+		t.Errorf("got version %s but wanted the one of the UI", v)
+	}
+
+	cc.Token = "token"
+	d, err := cc.Details(context.Background())
+	if err != nil {
+		t.Fatalf("unable to read details: %s", err)
+	}
+	if d.Version != "1.15.2" || d.Datacenter != "dc1" || d.Leader != "10.0.0.1:8300" || d.Peers != 3 || d.Voters != 2 {
+		t.Errorf("unexpected details %+v", d)
+	}
+	if d.AutopilotHealthy == nil || *d.AutopilotHealthy || !d.ConnectCAActive || d.ConnectCARoots != 2 {
+		t.Errorf("unexpected autopilot or CA details %+v", d)
+	}
+}
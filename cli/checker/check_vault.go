@@ -4,18 +4,29 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type VaultChecker struct {
 	GenericChecker
+	// AcceptStandby makes Status report the standby nodes as available.
+	AcceptStandby bool
 }
 
 type VaultResponse struct {
-	Version string `json:",omitempty"`
+	Version            string `json:"version,omitempty"`
+	Initialized        bool   `json:"initialized"`
+	Sealed             bool   `json:"sealed"`
+	Standby            bool   `json:"standby"`
+	PerformanceStandby bool   `json:"performance_standby"`
+	ClusterName        string `json:"cluster_name,omitempty"`
+}
+
+type vaultLeader struct {
+	LeaderAddress string `json:"leader_address"`
 }
 
 func NewVaultChecker(u, ca string, options ...func(*GenericChecker)) (vc VaultChecker, err error) {
@@ -35,26 +46,57 @@ func NewVaultChecker(u, ca string, options ...func(*GenericChecker)) (vc VaultCh
 }
 
 func (v VaultChecker) Status(ctx context.Context) bool {
-	u := "/v1/sys/health"
-	return v.GenericChecker.CheckURL(ctx, u)
+	return v.Health(ctx).Ready(v.AcceptStandby)
 }
 
-func (v VaultChecker) Version(ctx context.Context) (version string) {
-	u := "/v1/sys/health"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url+u, nil)
+// Health reads the state of the Vault node from /v1/sys/health, whose status code tells apart the
+// active (200), standby (429), performance standby (473), uninitialized (501) and sealed (503) nodes.
+func (v VaultChecker) Health(ctx context.Context) (h HealthResult) {
+	start := time.Now()
+	code, body, err := v.get(ctx, "/v1/sys/health", nil)
+	h.Latency = time.Since(start)
 	if err != nil {
-		log.Error().Msgf("error creating request: %s", err)
-		return fmt.Sprintf("error: %s\n", err)
+		h.State, h.Reason = Unreachable, err.Error()
+		return h
 	}
-	resp, err := v.Client.Do(req)
-	if err != nil {
-		log.Error().Msgf("error executing request: %s", err)
-		return fmt.Sprintf("error: %s\n", err)
+	r := VaultResponse{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		log.Debug().Msgf("unmarshal: %s error: %s", body, err)
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	h.Version, h.ClusterName = r.Version, r.ClusterName
+
+	switch code {
+	case http.StatusOK:
+		h.State = Healthy
+	case http.StatusTooManyRequests:
+		h.State, h.Reason = Standby, "node is a standby"
+	case 473:
+		h.State, h.Reason = PerfStandby, "node is a performance standby"
+	case 472:
+		h.State, h.Reason = Unhealthy, "node is a disaster recovery secondary"
+	case http.StatusNotImplemented:
+		h.State, h.Reason = Uninitialized, "the cluster must be initialized"
+	case http.StatusServiceUnavailable:
+		h.State, h.Reason = Sealed, "the node must be unsealed"
+	default:
+		h.State, h.Reason = Unhealthy, fmt.Sprintf("unexpected status code %d", code)
+	}
+
+	if h.State != Uninitialized && h.State != Sealed {
+		if _, body, err := v.get(ctx, "/v1/sys/leader", nil); err == nil {
+			l := vaultLeader{}
+			if err := json.Unmarshal(body, &l); err == nil {
+				h.Leader = l.LeaderAddress
+			}
+		}
+	}
+	return h
+}
+
+func (v VaultChecker) Version(ctx context.Context) (version string) {
+	_, body, err := v.get(ctx, "/v1/sys/health", nil)
 	if err != nil {
-		log.Error().Msgf("body: %s error: %s", body, err)
+		log.Error().Msgf("error executing request: %s", err)
 		return fmt.Sprintf("error: %s\n", err)
 	}
 	r := VaultResponse{}
@@ -0,0 +1,62 @@
+package checker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HealthState is the state of a tool as reported by its health endpoint.
+type HealthState string
+
+const (
+	// Healthy is the state of a tool serving requests, e.g. the active Vault node.
+	Healthy HealthState = "healthy"
+	// Standby is the state of a Vault standby node, forwarding the requests to the active one.
+	Standby HealthState = "standby"
+	// PerfStandby is the state of a Vault performance standby node, serving the read requests.
+	PerfStandby HealthState = "perfstandby"
+	// Sealed is the state of a Vault node that must be unsealed before serving requests.
+	Sealed HealthState = "sealed"
+	// Uninitialized is the state of a Vault cluster that was not initialized yet.
+	Uninitialized HealthState = "uninitialized"
+	// Unhealthy is the state of a tool answering with an error.
+	Unhealthy HealthState = "unhealthy"
+	// Unreachable is the state of a tool that could not be contacted.
+	Unreachable HealthState = "unreachable"
+)
+
+// HealthResult is the outcome of a health check.
+type HealthResult struct {
+	State HealthState
+	// Reason explains the state when the tool is not healthy.
+	Reason      string
+	Latency     time.Duration
+	Leader      string
+	ClusterName string
+	Version     string
+}
+
+// Ready tells whether the tool can serve requests, standby nodes included when acceptStandby is set.
+func (h HealthResult) Ready(acceptStandby bool) bool {
+	switch h.State {
+	case Healthy:
+		return true
+	case Standby, PerfStandby:
+		return acceptStandby
+	default:
+		return false
+	}
+}
+
+func (h HealthResult) String() string {
+	if h.Reason == "" {
+		return string(h.State)
+	}
+	return fmt.Sprintf("%s: %s", h.State, h.Reason)
+}
+
+// HealthChecker is implemented by the checkers reporting a structured health.
+type HealthChecker interface {
+	Health(ctx context.Context) HealthResult
+}
@@ -2,7 +2,9 @@ package cli
 
 import (
 	"caravan-cli/vault"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,54 +18,76 @@ import (
 const LogLevelInfo = "info"
 const LogLevelDebug = "debug"
 
+// DefaultTerraformVersion is the terraform release pinned by new projects.
+const DefaultTerraformVersion = "1.4.6"
+
 // Config is the main configuration data structure that is persisted to JSON.
 type Config struct {
-	Name                      string              `json:",omitempty"`
-	Region                    string              `json:",omitempty"`
-	Regions                   map[string][]string `json:",omitempty"`
-	Profile                   string              `json:",omitempty"`
-	Provider                  string              `json:",omitempty"`
-	Branch                    string              `json:",omitempty"`
-	LockName                  string              `json:",omitempty"`
-	StateStoreName            string              `json:",omitempty"`
-	Repos                     []string            `json:",omitempty"`
-	Domain                    string              `json:",omitempty"`
-	Workdir                   string              `json:",omitempty"`
-	WorkdirProject            string              `json:",omitempty"`
-	WorkdirBaking             string              `json:",omitempty"`
-	WorkdirBakingVars         string              `json:",omitempty"`
-	WorkdirInfra              string              `json:",omitempty"`
-	WorkdirInfraVars          string              `json:",omitempty"`
-	WorkdirInfraBackend       string              `json:",omitempty"`
-	WorkdirPlatform           string              `json:",omitempty"`
-	WorkdirPlatformVars       string              `json:",omitempty"`
-	WorkdirPlatformBackend    string              `json:",omitempty"`
-	WorkdirApplication        string              `json:",omitempty"`
-	WorkdirApplicationVars    string              `json:",omitempty"`
-	WorkdirApplicationBackend string              `json:",omitempty"`
-	Force                     bool                `json:",omitempty"`
-	Status                    Status              `json:",omitempty"`
-	VaultRootToken            string              `json:",omitempty"`
-	NomadToken                string              `json:",omitempty"`
-	VaultURL                  string              `json:",omitempty"`
-	CAPath                    string              `json:",omitempty"`
-	ServiceAccount            string              `json:",omitempty"`
-	Datacenter                string              `json:",omitempty"`
-	DeployNomad               bool                `json:",omitempty"`
-	LinuxOSFamily             string              `json:",omitempty"`
-	LinuxOSVersion            string              `json:",omitempty"`
-	LinuxOS                   string              `json:",omitempty"`
-	Edition                   string              `json:",omitempty"`
-	LogLevel                  string              `json:",omitempty"`
+	SchemaVersion             int                          `json:",omitempty"`
+	Name                      string                       `json:",omitempty"`
+	Region                    string                       `json:",omitempty"`
+	Regions                   map[string][]string          `json:",omitempty"`
+	Profile                   string                       `json:",omitempty"`
+	Provider                  string                       `json:",omitempty"`
+	Branch                    string                       `json:",omitempty"`
+	LockName                  string                       `json:",omitempty"`
+	StateStoreName            string                       `json:",omitempty"`
+	Repos                     []string                     `json:",omitempty"`
+	Domain                    string                       `json:",omitempty"`
+	Workdir                   string                       `json:",omitempty"`
+	WorkdirProject            string                       `json:",omitempty"`
+	WorkdirBaking             string                       `json:",omitempty"`
+	WorkdirBakingVars         string                       `json:",omitempty"`
+	WorkdirInfra              string                       `json:",omitempty"`
+	WorkdirInfraVars          string                       `json:",omitempty"`
+	WorkdirInfraBackend       string                       `json:",omitempty"`
+	WorkdirPlatform           string                       `json:",omitempty"`
+	WorkdirPlatformVars       string                       `json:",omitempty"`
+	WorkdirPlatformBackend    string                       `json:",omitempty"`
+	WorkdirApplication        string                       `json:",omitempty"`
+	WorkdirApplicationVars    string                       `json:",omitempty"`
+	WorkdirApplicationBackend string                       `json:",omitempty"`
+	Force                     bool                         `json:",omitempty"`
+	UseSavedPlan              bool                         `json:"-"`
+	Status                    Status                       `json:",omitempty"`
+	Layers                    map[DeployLayer]*LayerStatus `json:",omitempty"`
+	VaultRootToken            string                       `json:",omitempty"`
+	NomadToken                string                       `json:",omitempty"`
+	ConsulToken               string                       `json:",omitempty"`
+	ConsulTokenRole           string                       `json:",omitempty"`
+	VaultURL                  string                       `json:",omitempty"`
+	ConsulURL                 string                       `json:",omitempty"`
+	NomadURL                  string                       `json:",omitempty"`
+	LoadBalancerDNS           string                       `json:",omitempty"`
+	CAPath                    string                       `json:",omitempty"`
+	ServiceAccount            string                       `json:",omitempty"`
+	Datacenter                string                       `json:",omitempty"`
+	DeployNomad               bool                         `json:",omitempty"`
+	LinuxOSFamily             string                       `json:",omitempty"`
+	LinuxOSVersion            string                       `json:",omitempty"`
+	LinuxOS                   string                       `json:",omitempty"`
+	Edition                   string                       `json:",omitempty"`
+	LogLevel                  string                       `json:",omitempty"`
+	RemoteState               bool                         `json:",omitempty"`
+	Serial                    int64                        `json:",omitempty"`
+	RemoteSerial              int64                        `json:",omitempty"`
+	TerraformVersion          string                       `json:",omitempty"`
+	TerraformBinary           string                       `json:"-"`
+	Lease                     *Lease                       `json:",omitempty"`
 
 	GCPConfig
 	AzureConfig
+
+	remote      RemoteState
+	remoteCtx   context.Context
+	lease       *Lease
+	stopRenewal func()
 }
 
 // NewConfigFromScratch is used to construct a minimal configuration when no state
 // is yet persisted on a local state file.
 func NewConfigFromScratch(name, provider, region string) (c *Config, err error) {
-	wd := ".caravan"
+	wd := Workdir
 	repos := []string{"caravan-platform", "caravan-application-support"}
 
 	c = &Config{
@@ -84,18 +108,43 @@ func NewConfigFromScratch(name, provider, region string) (c *Config, err error)
 	return c, err
 }
 
-// NewConfigFromFile constructs a configuration from  the content of the state file (caravan.state).
-func NewConfigFromFile() (c *Config, err error) {
-	wd := ".caravan"
+// NewConfigFromFile constructs a configuration from the content of the state file (caravan.state) of the given project.
+// When no name is given the current project is loaded.
+func NewConfigFromFile(name string) (c *Config, err error) {
+	wd := Workdir
 	var b []byte
 
-	if b, err = os.ReadFile(filepath.Join(wd, "caravan.state")); err != nil {
+	if name == "" {
+		if name, err = CurrentProject(wd); err != nil {
+			return c, err
+		}
+	} else if err = migrateLegacyState(wd); err != nil {
+		return c, err
+	}
+
+	path := filepath.Join(wd, name, StateFile)
+	if b, err = os.ReadFile(path); err != nil {
 		return c, ConfigFileNotFound{Err: err}
 	}
 
-	if err = json.Unmarshal(b, &c); err != nil {
+	upgraded, version, err := upgradeState(b)
+	if err != nil {
 		return c, ConfigFileUnreadable{Err: err}
 	}
+	if err = json.Unmarshal(upgraded, &c); err != nil {
+		return c, ConfigFileUnreadable{Err: err}
+	}
+	if err = c.open(); err != nil {
+		return c, ConfigFileUnreadable{Err: err}
+	}
+	if version < SchemaVersion {
+		if err := backupState(path, b, version); err != nil {
+			return c, err
+		}
+		if err := os.WriteFile(path, upgraded, 0600); err != nil {
+			return c, err
+		}
+	}
 	return c, nil
 }
 
@@ -132,15 +181,21 @@ func (c *Config) SetBranch(branch string) {
 	c.Branch = branch
 }
 
+// RootTokenFile returns the path of the file the infrastructure layer writes the Vault root token to.
+func (c *Config) RootTokenFile() string {
+	return filepath.Join(c.WorkdirInfra, "."+c.Name+"-root_token")
+}
+
 // SetVaultRootToken reads the content of the token file into config.
 func (c *Config) SetVaultRootToken() error {
-	// TODO consolidate in constructor
-	vrt, err := os.ReadFile(filepath.Join(c.WorkdirInfra, "."+c.Name+"-root_token"))
+	vrt, err := os.ReadFile(c.RootTokenFile())
 	if err != nil {
 		return err
 	}
-	// TODO make more robust
-	c.VaultRootToken = string(vrt[0 : len(vrt)-1])
+	c.VaultRootToken = strings.TrimSpace(string(vrt))
+	if c.VaultRootToken == "" {
+		return fmt.Errorf("empty root token file %s", c.RootTokenFile())
+	}
 	return nil
 }
 
@@ -162,6 +217,31 @@ func (c *Config) SetDistro(d string) (err error) {
 	return nil
 }
 
+// SetConsulToken reads into config the Consul Token.
+func (c *Config) SetConsulToken() error {
+	t, err := c.ReadConsulToken()
+	if err != nil {
+		return err
+	}
+	log.Debug().Msgf("setting consul token")
+	c.ConsulToken = t
+
+	return nil
+}
+
+// ReadConsulToken reads a new Consul token from the Consul secrets engine of Vault, with the role
+// given by ConsulTokenRole.
+func (c *Config) ReadConsulToken() (string, error) {
+	if c.ConsulTokenRole == "" {
+		return "", errors.New("no vault role configured for the consul token")
+	}
+	v, err := vault.New(c.VaultURL, c.VaultRootToken, c.CAPath)
+	if err != nil {
+		return "", err
+	}
+	return v.GetToken("consul/creds/" + c.ConsulTokenRole)
+}
+
 // SetNomadToken reads into config the Nomad Token.
 func (c *Config) SetNomadToken() error {
 	v, err := vault.New(c.VaultURL, c.VaultRootToken, c.CAPath)
@@ -179,31 +259,54 @@ func (c *Config) SetNomadToken() error {
 	return nil
 }
 
-// Save serializes to JSON the configuration and a local state store (caravan.state).
+// Save serializes to JSON the configuration and a local state store (<project>/caravan.state).
+// When the remote state is enabled the state file is also pushed to the provider's state store, unless
+// the remote copy changed since it was last synced.
 func (c *Config) Save() {
-	data, err := json.MarshalIndent(c, "", " ")
-	if err != nil {
-		log.Panic().Msgf("unable to marshal config: %s", err)
-		panic("unable to mashall config")
+	c.renew()
+	c.Serial++
+	if err := c.write(); err != nil {
+		log.Panic().Msgf("unable to save config: %s", err)
+		panic("unable to save config")
+	}
+	if err := c.Sync(); err != nil {
+		log.Error().Msgf("unable to push state of project %s: %s", c.Name, err)
 	}
+}
+
+// SaveStatus persists the new status.
+func (c *Config) SaveStatus(status Status) {
+	c.SetStatus(status)
+	c.Save()
+	log.Debug().Msgf("status updated: %s -> %s", c.Status, status)
+}
 
-	err = os.MkdirAll(c.Workdir, os.ModePerm)
+func (c *Config) marshal() ([]byte, error) {
+	c.SchemaVersion = SchemaVersion
+	s, err := c.sealed()
 	if err != nil {
-		log.Panic().Msgf("unable to create config directory: %s", err)
-		panic("unable to create dir")
+		return nil, err
 	}
-
-	err = os.WriteFile(filepath.Join(c.Workdir, "caravan.state"), data, 0600)
+	data, err := json.MarshalIndent(s, "", " ")
 	if err != nil {
-		log.Panic().Msgf("unable to write config file: %s", err)
-		panic("unable to write file")
+		return nil, fmt.Errorf("unable to marshal config: %w", err)
 	}
+	return data, nil
 }
 
-func (c *Config) SaveStatus(status Status) {
-	c.Status = status
-	c.Save()
-	log.Debug().Msgf("status updated: %s -> %s", c.Status, status)
+// write persists the configuration to the local state file.
+func (c *Config) write() error {
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.StatePath()), os.ModePerm); err != nil {
+		return fmt.Errorf("unable to create config directory: %w", err)
+	}
+	if err := os.WriteFile(c.StatePath(), data, 0600); err != nil {
+		return fmt.Errorf("unable to write config file: %w", err)
+	}
+	return nil
 }
 
 // SetEdition sets the edition value in the config.
@@ -2,7 +2,10 @@ package cli_test
 
 import (
 	"caravan-cli/cli"
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -75,7 +78,7 @@ func TestConfigFromFile(t *testing.T) {
 		c.Save()
 		defer os.RemoveAll(c.Workdir)
 
-		got, err := cli.NewConfigFromFile()
+		got, err := cli.NewConfigFromFile(tc.name)
 		if err != nil {
 			t.Fatalf("unable to load config from file %s: %s\n", tc.name, err)
 		}
@@ -84,3 +87,102 @@ func TestConfigFromFile(t *testing.T) {
 		}
 	}
 }
+
+func TestProjects(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	for _, name := range []string{"name1", "name2"} {
+		c, err := cli.NewConfigFromScratch(name, "aws", "eu-south-1")
+		if err != nil {
+			t.Fatalf("unable to create config: %s\n", err)
+		}
+		c.Save()
+	}
+
+	projects, err := cli.ListProjects(cli.Workdir)
+	if err != nil {
+		t.Fatalf("unable to list projects: %s\n", err)
+	}
+	if strings.Join(projects, ",") != "name1,name2" {
+		t.Errorf("projects mismatch: got %s want %s", projects, "name1,name2")
+	}
+	if _, err := cli.NewConfigFromFile(""); err == nil {
+		t.Errorf("current project should be ambiguous with more than one project")
+	}
+	if err := cli.UseProject(cli.Workdir, "name3"); err == nil {
+		t.Errorf("missing project should not be selectable")
+	}
+	if err := cli.UseProject(cli.Workdir, "name2"); err != nil {
+		t.Fatalf("unable to select project: %s\n", err)
+	}
+	c, err := cli.NewConfigFromFile("")
+	if err != nil {
+		t.Fatalf("unable to load current project: %s\n", err)
+	}
+	if c.Name != "name2" {
+		t.Errorf("current project mismatch: got %s want %s", c.Name, "name2")
+	}
+
+	if err := c.Delete(); err != nil {
+		t.Fatalf("unable to delete project: %s\n", err)
+	}
+	got, err := cli.CurrentProject(cli.Workdir)
+	if err != nil {
+		t.Fatalf("unable to get current project: %s\n", err)
+	}
+	if got != "name1" {
+		t.Errorf("current project mismatch: got %s want %s", got, "name1")
+	}
+}
+
+func TestLegacyState(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	if err := os.MkdirAll(cli.Workdir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(cli.Workdir, cli.StateFile)
+	if err := os.WriteFile(legacy, []byte(`{"Name": "legacy", "Region": "eu-south-1"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cli.NewConfigFromFile("")
+	if err != nil {
+		t.Fatalf("unable to load legacy state: %s\n", err)
+	}
+	if c.Name != "legacy" || c.Region != "eu-south-1" {
+		t.Errorf("legacy state mismatch: got %s/%s", c.Name, c.Region)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy state not moved: %s", err)
+	}
+}
+
+func TestSetInfraOutputs(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(c.WorkdirInfra, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	outputs := map[string]json.RawMessage{cli.OutputConsulEndpoint: json.RawMessage(`"https://consul.example.com"`)}
+
+	if err := c.SetInfraOutputs(outputs); err == nil {
+		t.Errorf("missing root token accepted")
+	}
+
+	if err := os.WriteFile(c.RootTokenFile(), []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetInfraOutputs(outputs); err != nil || c.VaultRootToken != "file-token" {
+		t.Errorf("got root token %q (%v) but wanted the one of the token file", c.VaultRootToken, err)
+	}
+
+	outputs[cli.OutputVaultRootToken] = json.RawMessage(`"output-token"`)
+	if err := c.SetInfraOutputs(outputs); err != nil || c.VaultRootToken != "output-token" || c.ConsulURL != "https://consul.example.com" {
+		t.Errorf("got root token %q and consul %q (%v) but wanted the outputs", c.VaultRootToken, c.ConsulURL, err)
+	}
+}
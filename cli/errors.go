@@ -19,3 +19,20 @@ type ConfigFileUnreadable struct {
 func (e ConfigFileUnreadable) Error() string {
 	return fmt.Sprintf("config file unreadable: %s", e.Err.Error())
 }
+
+type RemoteStateNotFound struct {
+	Err error
+}
+
+func (e RemoteStateNotFound) Error() string {
+	return fmt.Sprintf("remote state not found: %s", e.Err.Error())
+}
+
+// RemoteStateConflict is returned when the remote copy of the state file changed since it was last synced.
+type RemoteStateConflict struct {
+	Err error
+}
+
+func (e RemoteStateConflict) Error() string {
+	return fmt.Sprintf("remote state conflict: %s", e.Err.Error())
+}
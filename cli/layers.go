@@ -1,5 +1,15 @@
 package cli
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
 type DeployLayer int
 
 const (
@@ -7,3 +17,286 @@ const (
 	Platform
 	ApplicationSupport
 )
+
+// Layers are the deploy layers in the order they are applied by up.
+var Layers = []DeployLayer{Infrastructure, Platform, ApplicationSupport}
+
+func (l DeployLayer) String() string {
+	switch l {
+	case Infrastructure:
+		return "infra"
+	case Platform:
+		return "platform"
+	case ApplicationSupport:
+		return "application"
+	default:
+		return fmt.Sprintf("unknown-%d", int(l))
+	}
+}
+
+func (l DeployLayer) MarshalText() ([]byte, error) {
+	if l < Infrastructure || l > ApplicationSupport {
+		return nil, fmt.Errorf("unknown layer: %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+func (l *DeployLayer) UnmarshalText(b []byte) error {
+	v, err := ParseLayer(string(b))
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// ParseLayer returns the layer with the given name.
+func ParseLayer(name string) (DeployLayer, error) {
+	for _, l := range Layers {
+		if l.String() == name {
+			return l, nil
+		}
+	}
+	return Infrastructure, fmt.Errorf("unknown layer %s: must be one of infra, platform or application", name)
+}
+
+// Deployed returns the status reached once the layer is deployed and checked.
+func (l DeployLayer) Deployed() Status {
+	switch l {
+	case Infrastructure:
+		return InfraCheckDone
+	case Platform:
+		return PlatformConsulDeployDone
+	default:
+		return ApplicationDeployDone
+	}
+}
+
+// Cleaned returns the status of a project with the layer destroyed and the layers below still deployed:
+// it is the status up resumes the layer from.
+func (l DeployLayer) Cleaned() Status {
+	switch l {
+	case Infrastructure:
+		return InfraCleanDone
+	case Platform:
+		return PlatformCleanDone
+	default:
+		return ApplicationCleanDone
+	}
+}
+
+// LayerWorkdir returns the terraform working directory of the given layer.
+func (c *Config) LayerWorkdir(l DeployLayer) string {
+	switch l {
+	case Infrastructure:
+		return c.WorkdirInfra
+	case Platform:
+		return c.WorkdirPlatform
+	case ApplicationSupport:
+		return c.WorkdirApplication
+	default:
+		return ""
+	}
+}
+
+// LayerVars returns the terraform variables file of the given layer.
+func (c *Config) LayerVars(l DeployLayer) string {
+	switch l {
+	case Infrastructure:
+		return c.WorkdirInfraVars
+	case Platform:
+		return c.WorkdirPlatformVars
+	case ApplicationSupport:
+		return c.WorkdirApplicationVars
+	default:
+		return ""
+	}
+}
+
+// LayerPlan returns the path of the saved terraform plan of the given layer.
+func (c *Config) LayerPlan(l DeployLayer) string {
+	wd := c.LayerWorkdir(l)
+	if wd == "" {
+		return ""
+	}
+	return filepath.Join(wd, c.Name+"-"+l.String()+".tfplan")
+}
+
+// LayerState is the deployment state of a layer.
+type LayerState string
+
+const (
+	LayerPending    LayerState = ""
+	LayerApplying   LayerState = "Applying"
+	LayerApplied    LayerState = "Applied"
+	LayerChecking   LayerState = "Checking"
+	LayerReady      LayerState = "Ready"
+	LayerDestroying LayerState = "Destroying"
+	LayerDestroyed  LayerState = "Destroyed"
+)
+
+// Deployed tells whether the layer has resources that clean must destroy.
+func (s LayerState) Deployed() bool {
+	return s != LayerPending && s != LayerDestroyed
+}
+
+// LayerStatus is the state of a deploy layer persisted in the config.
+type LayerStatus struct {
+	State            LayerState `json:",omitempty"`
+	LastApply        *time.Time `json:",omitempty"`
+	TerraformVersion string     `json:",omitempty"`
+	Commit           string     `json:",omitempty"`
+	LastError        string     `json:",omitempty"`
+	Interrupted      bool       `json:",omitempty"`
+}
+
+// layerStatuses maps the state of each layer to the project status it stands for.
+var layerStatuses = map[DeployLayer]map[LayerState]Status{
+	Infrastructure: {
+		LayerDestroyed:  InfraCleanDone,
+		LayerDestroying: InfraCleanRunning,
+		LayerApplying:   InfraDeployRunning,
+		LayerApplied:    InfraDeployDone,
+		LayerChecking:   InfraCheckRunning,
+		LayerReady:      InfraCheckDone,
+	},
+	Platform: {
+		LayerDestroyed:  PlatformCleanDone,
+		LayerDestroying: PlatformCleanRunning,
+		LayerApplying:   PlatformDeployRunning,
+		LayerApplied:    PlatformDeployDone,
+		LayerChecking:   PlatformConsulDeployRunning,
+		LayerReady:      PlatformConsulDeployDone,
+	},
+	ApplicationSupport: {
+		LayerDestroyed:  ApplicationCleanDone,
+		LayerDestroying: ApplicationCleanRunning,
+		LayerApplying:   ApplicationDeployRunning,
+		LayerApplied:    ApplicationDeployDone,
+		LayerReady:      ApplicationDeployDone,
+	},
+}
+
+// interruptedStatus returns the status an operation on the layer interrupted in the given state started
+// from, as the operation is no longer running: the layer is then retried or cleaned from there.
+func interruptedStatus(l DeployLayer, state LayerState) Status {
+	switch state {
+	case LayerApplying:
+		return l.Cleaned()
+	case LayerChecking:
+		return layerStatuses[l][LayerApplied]
+	case LayerDestroying:
+		return l.Deployed()
+	default:
+		return layerStatuses[l][state]
+	}
+}
+
+// Layer returns the state of the given layer.
+func (c *Config) Layer(l DeployLayer) *LayerStatus {
+	if c.Layers == nil {
+		c.Layers = map[DeployLayer]*LayerStatus{}
+	}
+	if c.Layers[l] == nil {
+		c.Layers[l] = &LayerStatus{}
+	}
+	return c.Layers[l]
+}
+
+// Deployable checks that the layers below the given one are ready.
+func (c *Config) Deployable(l DeployLayer) error {
+	for _, below := range Layers[:l] {
+		if s := c.Layer(below).State; s != LayerReady {
+			return fmt.Errorf("layer %s requires layer %s to be deployed, but it is %s", l, below, s)
+		}
+	}
+	return nil
+}
+
+func (s LayerState) String() string {
+	if s == LayerPending {
+		return "Pending"
+	}
+	return string(s)
+}
+
+// SaveLayerState persists the new state of the layer, together with the status derived from
+// the states of all the layers.
+func (c *Config) SaveLayerState(l DeployLayer, state LayerState) {
+	ls := c.Layer(l)
+	ls.State = state
+	switch state {
+	case LayerApplying, LayerChecking, LayerDestroying:
+		ls.LastError = ""
+		ls.Interrupted = false
+	}
+	c.Status = c.layersStatus()
+	c.Save()
+	log.Debug().Msgf("layer %s state updated: %s (%s)", l, state, c.Status)
+}
+
+// SaveLayerApplied records a successful apply of the layer with the given terraform version and git commit.
+func (c *Config) SaveLayerApplied(l DeployLayer, version, commit string) {
+	now := time.Now().UTC()
+	ls := c.Layer(l)
+	ls.LastApply = &now
+	ls.TerraformVersion = version
+	ls.Commit = commit
+	ls.LastError = ""
+	c.SaveLayerState(l, LayerApplied)
+}
+
+// SaveLayerError records the error a layer operation failed with, leaving the layer in its current state.
+// An operation stopped by the cancellation of its context is recorded as interrupted, and the project status
+// is no longer a running one.
+func (c *Config) SaveLayerError(l DeployLayer, err error) {
+	ls := c.Layer(l)
+	ls.LastError = err.Error()
+	ls.Interrupted = errors.Is(err, context.Canceled)
+	c.Status = c.layersStatus()
+	c.Save()
+}
+
+// SetStatus sets the project status and the layer states it stands for: the layers below the one the status
+// refers to are ready, the ones above pending.
+func (c *Config) SetStatus(status Status) {
+	c.Status = status
+	for _, ls := range c.Layers {
+		ls.State = LayerPending
+		ls.Interrupted = false
+	}
+	for _, l := range Layers {
+		for state, s := range layerStatuses[l] {
+			if s != status || (l == ApplicationSupport && state == LayerApplied) {
+				continue
+			}
+			for _, below := range Layers[:l] {
+				c.Layer(below).State = LayerReady
+			}
+			c.Layer(l).State = state
+		}
+	}
+}
+
+// layersStatus derives the project status from the layer states: it is the status of the lowest
+// layer that is not ready, or of the top layer when all of them are.
+func (c *Config) layersStatus() Status {
+	status := c.Status
+	if status > BakingDone {
+		status = BakingDone
+	}
+	for _, l := range Layers {
+		ls := c.Layer(l)
+		if ls.State == LayerPending {
+			break
+		}
+		status = layerStatuses[l][ls.State]
+		if ls.Interrupted {
+			status = interruptedStatus(l, ls.State)
+		}
+		if ls.State != LayerReady {
+			break
+		}
+	}
+	return status
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LockFile is the name of the file locking each project against concurrent caravan processes on the same host.
+const LockFile = "caravan.lock"
+
+// LeaseTTL is the time after which the lease of a process running on another host is considered stale
+// when it is not renewed.
+const LeaseTTL = 2 * time.Hour
+
+// LeaseRenewInterval is how often the lease is renewed in the remote state while the process runs.
+var LeaseRenewInterval = LeaseTTL / 4
+
+// Lease records the caravan process operating on a project.
+type Lease struct {
+	PID      int
+	Host     string
+	Command  string
+	Acquired time.Time
+	Renewed  time.Time
+}
+
+func (l Lease) String() string {
+	return fmt.Sprintf("%s (pid %d on %s, since %s)", l.Command, l.PID, l.Host, l.Acquired.Local().Format(time.RFC3339))
+}
+
+// heldBy tells whether the lease is the one acquired by the process holding l.
+func (l Lease) heldBy(o Lease) bool {
+	return l.PID == o.PID && l.Host == o.Host && l.Command == o.Command && l.Acquired.Equal(o.Acquired)
+}
+
+// Stale tells whether the process holding the lease is gone: on the local host its PID is checked,
+// on other hosts the lease expires when it is not renewed within LeaseTTL.
+func (l Lease) Stale() bool {
+	host, _ := os.Hostname()
+	if l.Host == host {
+		return l.PID != os.Getpid() && !processAlive(l.PID)
+	}
+	return time.Since(l.Renewed) > LeaseTTL
+}
+
+// ProjectLocked is returned when another caravan process holds the lease of the project.
+type ProjectLocked struct {
+	Name  string
+	Lease Lease
+}
+
+func (e ProjectLocked) Error() string {
+	return fmt.Sprintf("project %s is locked by %s", e.Name, e.Lease)
+}
+
+// LockPath returns the path of the lock file of the project.
+func (c *Config) LockPath() string {
+	return filepath.Join(c.Workdir, c.Name, LockFile)
+}
+
+// Lock acquires the lease of the project for the given command, both in the local lock file and in the
+// state, so that it is also seen by the processes sharing the remote state. The remote state is only
+// written if it did not change since it was read, so that two hosts cannot both acquire the lease, and
+// the lease is then renewed in it until Unlock. The lease of a process that died is taken over and
+// returned as stale.
+func (c *Config) Lock(command string) (stale *Lease, err error) {
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	lease := Lease{PID: os.Getpid(), Host: host, Command: command, Acquired: now, Renewed: now}
+
+	if stale, err = c.lockFile(lease); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(c.LockPath())
+		}
+	}()
+	version, err := c.sync()
+	if err != nil {
+		return nil, fmt.Errorf("unable to sync state of project %s: %w", c.Name, err)
+	}
+	prev := c.Lease
+	if prev != nil {
+		if !prev.Stale() && (prev.Host != host || prev.PID != os.Getpid()) {
+			return nil, ProjectLocked{Name: c.Name, Lease: *prev}
+		}
+		if stale == nil {
+			held := *prev
+			stale = &held
+		}
+	}
+
+	c.Lease = &lease
+	c.Serial++
+	if c.remote != nil && c.RemoteState {
+		_, err = c.push(version)
+	} else {
+		err = c.write()
+	}
+	if err != nil {
+		c.Lease = prev
+		c.Serial--
+		if errors.As(err, &RemoteStateConflict{}) {
+			return nil, fmt.Errorf("unable to acquire the lease of project %s, its state changed meanwhile: %w", c.Name, err)
+		}
+		return nil, err
+	}
+	c.lease = &lease
+	if c.remote != nil && c.RemoteState {
+		c.renewLease(lease)
+	}
+	return stale, nil
+}
+
+// renewLease renews the lease in the remote state every LeaseRenewInterval until Unlock, so that it does
+// not expire while a long command runs. On the local host the lease is checked by PID and needs no renewal.
+// The remote state is updated on its own, as the configuration is not safe for concurrent use.
+func (c *Config) renewLease(lease Lease) {
+	name, remote := c.Name, c.remote
+	ctx, cancel := context.WithCancel(c.remoteCtx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(LeaseRenewInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			if err := renewRemoteLease(ctx, remote, lease); err != nil && ctx.Err() == nil {
+				log.Warn().Msgf("unable to renew lease of project %s: %s", name, err)
+			}
+		}
+	}()
+	c.stopRenewal = func() {
+		cancel()
+		<-done
+	}
+}
+
+// renewRemoteLease updates the renewal time of the lease in the remote state, if it is still held.
+func renewRemoteLease(ctx context.Context, remote RemoteState, lease Lease) error {
+	data, version, err := remote.PullState(ctx)
+	if err != nil {
+		return err
+	}
+	if data, _, err = upgradeState(data); err != nil {
+		return err
+	}
+	// the secrets are left sealed, as they are
+	s := &Config{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	if s.Lease == nil || !s.Lease.heldBy(lease) {
+		return fmt.Errorf("lease taken over by %v", s.Lease)
+	}
+	s.Lease.Renewed = time.Now().UTC()
+	if data, err = s.marshal(); err != nil {
+		return err
+	}
+	_, err = remote.PushState(ctx, data, version)
+	return err
+}
+
+// lockFile creates the local lock file, replacing the one of a process that died.
+func (c *Config) lockFile(lease Lease) (*Lease, error) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.LockPath()), os.ModePerm); err != nil {
+		return nil, err
+	}
+	var stale *Lease
+	for {
+		f, err := os.OpenFile(c.LockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return stale, err
+		}
+		if !errors.Is(err, os.ErrExist) || stale != nil {
+			return nil, fmt.Errorf("unable to create lock file: %w", err)
+		}
+		held := Lease{}
+		b, err := os.ReadFile(c.LockPath())
+		if err != nil {
+			return nil, fmt.Errorf("unable to read lock file: %w", err)
+		}
+		if err := json.Unmarshal(b, &held); err != nil {
+			log.Warn().Msgf("removing unreadable lock file %s: %s", c.LockPath(), err)
+		} else if !held.Stale() {
+			return nil, ProjectLocked{Name: c.Name, Lease: held}
+		}
+		if err := os.Remove(c.LockPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("unable to remove stale lock file: %w", err)
+		}
+		stale = &held
+	}
+}
+
+// Unlock releases the lease of the project held by this process.
+func (c *Config) Unlock() error {
+	if c.lease == nil {
+		return nil
+	}
+	if c.stopRenewal != nil {
+		c.stopRenewal()
+		c.stopRenewal = nil
+	}
+	c.lease = nil
+	if c.Lease != nil {
+		c.Lease = nil
+		if _, err := os.Stat(c.StatePath()); err == nil {
+			c.Save()
+		}
+	}
+	if err := os.Remove(c.LockPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove lock file: %w", err)
+	}
+	return nil
+}
+
+// renew updates the lease held by this process before the state is saved.
+func (c *Config) renew() {
+	if c.lease == nil {
+		return
+	}
+	c.lease.Renewed = time.Now().UTC()
+	c.Lease = c.lease
+}
+
+// Stalled returns the layers left in a running state by a process that did not report any error,
+// as it happens when it is killed.
+func (c *Config) Stalled() []DeployLayer {
+	var layers []DeployLayer
+	for _, l := range Layers {
+		ls := c.Layers[l]
+		if ls == nil {
+			continue
+		}
+		switch ls.State {
+		case LayerApplying, LayerChecking, LayerDestroying:
+			if ls.LastError == "" {
+				layers = append(layers, l)
+			}
+		}
+	}
+	return layers
+}
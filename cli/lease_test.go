@@ -0,0 +1,162 @@
+package cli_test
+
+import (
+	"caravan-cli/cli"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Save()
+
+	// a process on another host renewed its lease recently
+	c.Lease = &cli.Lease{PID: 1, Host: host + "-other", Command: "up", Renewed: time.Now()}
+	c.Save()
+	if _, err := c.Lock("up"); !errors.As(err, &cli.ProjectLocked{}) {
+		t.Fatalf("got error %v but wanted the project to be locked", err)
+	}
+	if _, err := os.Stat(c.LockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind")
+	}
+
+	// the lease expired
+	c.Lease.Renewed = time.Now().Add(-cli.LeaseTTL - time.Minute)
+	c.Save()
+	stale, err := c.Lock("up")
+	if err != nil {
+		t.Fatalf("unable to lock: %s", err)
+	}
+	if stale == nil || stale.Host != host+"-other" {
+		t.Errorf("got stale lease %v but wanted the expired one", stale)
+	}
+	if c.Lease == nil || c.Lease.PID != os.Getpid() {
+		t.Errorf("lease not saved: %v", c.Lease)
+	}
+
+	// a second process on the same host
+	other, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Lock("clean"); !errors.As(err, &cli.ProjectLocked{}) {
+		t.Errorf("got error %v but wanted the project to be locked", err)
+	}
+
+	if err := c.Unlock(); err != nil {
+		t.Fatalf("unable to unlock: %s", err)
+	}
+	if _, err := os.Stat(c.LockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file not removed")
+	}
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Lease != nil {
+		t.Errorf("lease not released: %v", got.Lease)
+	}
+}
+
+func TestLockStale(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+	host, _ := os.Hostname()
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetStatus(cli.InfraDeployRunning)
+	c.Save()
+	// no process can have the largest PID
+	b, _ := json.Marshal(cli.Lease{PID: 1<<31 - 1, Host: host, Command: "up"})
+	if err := os.WriteFile(c.LockPath(), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := c.Lock("up")
+	if err != nil {
+		t.Fatalf("stale lock not taken over: %s", err)
+	}
+	if stale == nil || stale.PID != 1<<31-1 {
+		t.Errorf("got stale lease %v but wanted the one of the lock file", stale)
+	}
+	if got := c.Stalled(); len(got) != 1 || got[0] != cli.Infrastructure {
+		t.Errorf("got interrupted layers %v but wanted infra", got)
+	}
+	_ = c.Unlock()
+}
+
+func TestLockRemote(t *testing.T) {
+	ctx := context.Background()
+	defer os.RemoveAll(cli.Workdir)
+	remote := &memoryState{}
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RemoteState = true
+	c.SetRemoteState(ctx, remote)
+	c.Save()
+
+	// another host writes the state between the read and the write of the lease
+	remote.beforePush = func(m *memoryState) {
+		m.beforePush = nil
+		m.generation++
+	}
+	if _, err := c.Lock("up"); !errors.As(err, &cli.RemoteStateConflict{}) {
+		t.Fatalf("got error %v but wanted a conflict", err)
+	}
+	if c.Lease != nil {
+		t.Errorf("lease kept after a conflict: %v", c.Lease)
+	}
+	if _, err := os.Stat(c.LockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file left behind")
+	}
+
+	defer func(d time.Duration) { cli.LeaseRenewInterval = d }(cli.LeaseRenewInterval)
+	cli.LeaseRenewInterval = 10 * time.Millisecond
+	if _, err := c.Lock("up"); err != nil {
+		t.Fatalf("unable to lock: %s", err)
+	}
+	acquired := remote.state(t).Lease
+	if acquired == nil || acquired.PID != os.Getpid() {
+		t.Fatalf("lease not pushed: %v", acquired)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if l := remote.state(t).Lease; l != nil && l.Renewed.After(acquired.Renewed) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lease not renewed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the renewals do not get in the way of the saves
+	c.SaveStatus(cli.InfraDeployRunning)
+	if got := remote.state(t); got.Status != cli.InfraDeployRunning {
+		t.Errorf("state not pushed while renewing the lease: got %s", got.Status)
+	}
+	if err := c.Unlock(); err != nil {
+		t.Fatalf("unable to unlock: %s", err)
+	}
+	if l := remote.state(t).Lease; l != nil {
+		t.Errorf("lease not released: %v", l)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package cli
+
+import (
+	"os"
+)
+
+// processAlive tells whether a process with the given PID is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// migration upgrades a state document by one schema version.
+type migration struct {
+	Description string
+	Migrate     func(doc map[string]interface{}) error
+}
+
+// migrations is the registry of the state schema upgrades: the migration at index i upgrades
+// a document from version i to version i+1. New migrations must only be appended.
+var migrations = []migration{
+	{Description: "persist the status by name", Migrate: migrateStatusName},
+	{Description: "track the state of each layer", Migrate: migrateLayers},
+}
+
+// SchemaVersion is the version of the state document written by this version of caravan.
+var SchemaVersion = len(migrations)
+
+// upgradeState applies to the state document the migrations needed to bring it to the current schema version.
+// It returns the upgraded document and the version it was upgraded from.
+func upgradeState(b []byte) ([]byte, int, error) {
+	doc := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, 0, err
+	}
+
+	from := 0
+	if v, ok := doc["SchemaVersion"]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid schema version: %v", v)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid schema version: %w", err)
+		}
+		from = int(i)
+	}
+	if from > SchemaVersion {
+		return nil, from, fmt.Errorf("state schema version %d is newer than the supported one (%d): please upgrade caravan", from, SchemaVersion)
+	}
+	if from == SchemaVersion {
+		return b, from, nil
+	}
+
+	for v := from; v < SchemaVersion; v++ {
+		log.Debug().Msgf("upgrading state from schema version %d to %d: %s", v, v+1, migrations[v].Description)
+		if err := migrations[v].Migrate(doc); err != nil {
+			return nil, from, fmt.Errorf("error upgrading state to schema version %d: %w", v+1, err)
+		}
+	}
+	doc["SchemaVersion"] = SchemaVersion
+	out, err := json.MarshalIndent(doc, "", " ")
+	if err != nil {
+		return nil, from, err
+	}
+	return out, from, nil
+}
+
+// backupState keeps a copy of a state file before it is upgraded.
+func backupState(path string, b []byte, version int) error {
+	bak := filepath.Join(filepath.Dir(path), fmt.Sprintf("%s.v%d.bak", filepath.Base(path), version))
+	log.Info().Msgf("upgrading state schema from version %d to %d: backup saved to %s", version, SchemaVersion, bak)
+	return os.WriteFile(bak, b, 0600)
+}
+
+// legacyStatuses is the order of the statuses when they were persisted by their ordinal value.
+var legacyStatuses = []string{
+	"InitMissing",
+	"InitRunning",
+	"InitDone",
+	"BakingDone",
+	"InfraCleanDone",
+	"InfraCleanRunning",
+	"InfraDeployRunning",
+	"InfraDeployDone",
+	"InfraCheckRunning",
+	"InfraCheckDone",
+	"PlatformCleanDone",
+	"PlatformCleanRunning",
+	"PlatformDeployRunning",
+	"PlatformDeployDone",
+	"PlatformConsulDeployRunning",
+	"PlatformConsulDeployDone",
+	"ApplicationCleanDone",
+	"ApplicationCleanRunning",
+	"ApplicationDeployRunning",
+	"ApplicationDeployDone",
+}
+
+func migrateStatusName(doc map[string]interface{}) error {
+	v, ok := doc["Status"]
+	if !ok {
+		return nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return fmt.Errorf("invalid legacy status: %v", v)
+	}
+	i, err := n.Int64()
+	if err != nil || i < 0 || int(i) >= len(legacyStatuses) {
+		return fmt.Errorf("invalid legacy status: %v", v)
+	}
+	doc["Status"] = legacyStatuses[i]
+	return nil
+}
+
+func migrateLayers(doc map[string]interface{}) error {
+	v, ok := doc["Status"]
+	if !ok {
+		return nil
+	}
+	name, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("invalid status: %v", v)
+	}
+	s, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+	c := &Config{}
+	c.SetStatus(s)
+	if c.Layers == nil {
+		return nil
+	}
+	b, err := json.Marshal(c.Layers)
+	if err != nil {
+		return err
+	}
+	var layers interface{}
+	if err := json.Unmarshal(b, &layers); err != nil {
+		return err
+	}
+	doc["Layers"] = layers
+	return nil
+}
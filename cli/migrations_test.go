@@ -0,0 +1,128 @@
+package cli_test
+
+import (
+	"caravan-cli/cli"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatusJSON(t *testing.T) {
+	b, err := json.Marshal(struct{ Status cli.Status }{Status: cli.InfraCheckDone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"Status":"InfraCheckDone"}` {
+		t.Errorf("status not serialized by name: %s", b)
+	}
+	got := struct{ Status cli.Status }{}
+	if err := json.Unmarshal(b, &got); err != nil || got.Status != cli.InfraCheckDone {
+		t.Errorf("got %s (%v) but wanted %s", got.Status, err, cli.InfraCheckDone)
+	}
+	if err := json.Unmarshal([]byte(`{"Status":"NoSuchStatus"}`), &got); err == nil {
+		t.Errorf("unknown status accepted")
+	}
+}
+
+func TestStateUpgrade(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	type tc struct {
+		desc   string
+		state  string
+		status cli.Status
+		layers map[cli.DeployLayer]cli.LayerState
+		backup bool
+		error  bool
+	}
+	tests := []tc{
+		{desc: "legacy ordinal status", state: `{"Name": "name1", "Status": 7}`, status: cli.InfraDeployDone, layers: map[cli.DeployLayer]cli.LayerState{cli.Infrastructure: cli.LayerApplied}, backup: true},
+		{desc: "legacy missing status", state: `{"Name": "name1"}`, status: cli.InitMissing, backup: true},
+		{desc: "status by name", state: `{"SchemaVersion": 1, "Name": "name1", "Status": "PlatformDeployDone"}`, status: cli.PlatformDeployDone, layers: map[cli.DeployLayer]cli.LayerState{cli.Infrastructure: cli.LayerReady, cli.Platform: cli.LayerApplied}},
+		{desc: "current schema", state: `{"SchemaVersion": 2, "Name": "name1", "Status": "InfraCleanDone", "Layers": {"infra": {"State": "Destroyed"}}}`, status: cli.InfraCleanDone, layers: map[cli.DeployLayer]cli.LayerState{cli.Infrastructure: cli.LayerDestroyed}},
+		{desc: "invalid legacy status", state: `{"Name": "name1", "Status": 42}`, error: true},
+		{desc: "newer schema", state: `{"SchemaVersion": 99, "Name": "name1", "Status": "InitDone"}`, error: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.desc, func(t *testing.T) {
+			os.RemoveAll(cli.Workdir)
+			path := filepath.Join(cli.Workdir, "name1", cli.StateFile)
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tc.state), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := cli.NewConfigFromFile("name1")
+			if tc.error {
+				if err == nil {
+					t.Errorf("state loaded but an error was expected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to load state: %s", err)
+			}
+			if c.Status != tc.status {
+				t.Errorf("got %s but wanted %s", c.Status, tc.status)
+			}
+			for _, l := range cli.Layers {
+				if got := c.Layer(l).State; got != tc.layers[l] {
+					t.Errorf("got layer %s %s but wanted %s", l, got, tc.layers[l])
+				}
+			}
+			if c.SchemaVersion != cli.SchemaVersion {
+				t.Errorf("got schema version %d but wanted %d", c.SchemaVersion, cli.SchemaVersion)
+			}
+
+			bak, err := os.ReadFile(path + ".v0.bak")
+			if tc.backup && (err != nil || string(bak) != tc.state) {
+				t.Errorf("backup not saved: %s (%v)", bak, err)
+			}
+			if !tc.backup && err == nil {
+				t.Errorf("unexpected backup of a current state")
+			}
+			b, _ := os.ReadFile(path)
+			if tc.backup && strings.Contains(string(b), `"Status": 7`) {
+				t.Errorf("upgraded state not saved:\n%s", b)
+			}
+		})
+	}
+}
+
+func TestLayerStatus(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetStatus(cli.ApplicationDeployDone)
+
+	c.SaveLayerState(cli.Platform, cli.LayerApplying)
+	if c.Status != cli.PlatformDeployRunning {
+		t.Errorf("got status %s but wanted %s", c.Status, cli.PlatformDeployRunning)
+	}
+	if err := c.Deployable(cli.ApplicationSupport); err == nil {
+		t.Errorf("application deployable on a platform being applied")
+	}
+	c.SaveLayerError(cli.Platform, errors.New("boom"))
+	c.SaveLayerApplied(cli.Platform, "1.4.6", "abc")
+	if ls := c.Layer(cli.Platform); ls.LastError != "" || ls.LastApply == nil || ls.TerraformVersion != "1.4.6" || ls.Commit != "abc" {
+		t.Errorf("apply not recorded: %+v", ls)
+	}
+	c.SaveLayerState(cli.Platform, cli.LayerReady)
+	if c.Status != cli.ApplicationDeployDone {
+		t.Errorf("got status %s but wanted %s", c.Status, cli.ApplicationDeployDone)
+	}
+
+	c.SaveLayerState(cli.ApplicationSupport, cli.LayerDestroyed)
+	if c.Status != cli.ApplicationCleanDone {
+		t.Errorf("got status %s but wanted %s", c.Status, cli.ApplicationCleanDone)
+	}
+}
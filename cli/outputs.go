@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the infrastructure layer outputs read back into the config.
+const (
+	OutputVaultEndpoint   = "vault_endpoint"
+	OutputConsulEndpoint  = "consul_endpoint"
+	OutputNomadEndpoint   = "nomad_endpoint"
+	OutputCACerts         = "ca_certs"
+	OutputVaultRootToken  = "vault_root_token"
+	OutputLoadBalancerDNS = "load_balancer_dns"
+	OutputDatacenter      = "datacenter"
+)
+
+// SetInfraOutputs fills the config with the outputs of the infrastructure layer, given as their JSON
+// values, and writes the CA bundle to CAPath. Missing outputs keep the current values. The Vault root
+// token is required: when the infrastructure layer does not output it, it is read from the token file
+// written by the layer, as the infra modules not exporting the outputs do.
+func (c *Config) SetInfraOutputs(outputs map[string]json.RawMessage) error {
+	fields := map[string]*string{
+		OutputVaultEndpoint:   &c.VaultURL,
+		OutputConsulEndpoint:  &c.ConsulURL,
+		OutputNomadEndpoint:   &c.NomadURL,
+		OutputVaultRootToken:  &c.VaultRootToken,
+		OutputLoadBalancerDNS: &c.LoadBalancerDNS,
+		OutputDatacenter:      &c.Datacenter,
+	}
+	for name, field := range fields {
+		v, ok := outputs[name]
+		if !ok {
+			log.Debug().Msgf("infra output %s not found", name)
+			continue
+		}
+		if err := json.Unmarshal(v, field); err != nil {
+			return fmt.Errorf("infra output %s is not a string: %w", name, err)
+		}
+	}
+	if c.VaultRootToken == "" {
+		log.Debug().Msgf("reading the vault root token from %s", c.RootTokenFile())
+		if err := c.SetVaultRootToken(); err != nil {
+			return fmt.Errorf("infra output %s not found and unable to read the root token file: %w", OutputVaultRootToken, err)
+		}
+	}
+
+	if v, ok := outputs[OutputCACerts]; ok {
+		ca := ""
+		if err := json.Unmarshal(v, &ca); err != nil {
+			return fmt.Errorf("infra output %s is not a string: %w", OutputCACerts, err)
+		}
+		if err := os.WriteFile(c.CAPath, []byte(ca), 0o644); err != nil { // nolint:gosec // CA certificates are public
+			return fmt.Errorf("error writing CA bundle: %w", err)
+		}
+	}
+	return nil
+}
+
+// Endpoint returns the URL of the given tool, as reported by the infrastructure outputs when known.
+func (c *Config) Endpoint(tool string) string {
+	u := ""
+	switch tool {
+	case Vault:
+		u = c.VaultURL
+	case Consul:
+		u = c.ConsulURL
+	case Nomad:
+		u = c.NomadURL
+	}
+	if u == "" {
+		u = fmt.Sprintf("https://%s.%s.%s", tool, c.Name, c.Domain)
+	}
+	return u
+}
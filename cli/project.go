@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Workdir is the local directory holding the caravan projects.
+	Workdir = ".caravan"
+	// StateFile is the name of the state file of each project.
+	StateFile = "caravan.state"
+
+	currentProjectFile = "current"
+)
+
+// ListProjects returns the names of the projects having a state file in the given workdir.
+func ListProjects(wd string) (projects []string, err error) {
+	if err := migrateLegacyState(wd); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(wd)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return projects, nil
+		}
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(wd, e.Name(), StateFile)); err == nil {
+			projects = append(projects, e.Name())
+		}
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// CurrentProject returns the project the commands act on when none is given explicitly.
+// It is the project selected with UseProject or, when none was selected, the only project available.
+func CurrentProject(wd string) (string, error) {
+	projects, err := ListProjects(wd)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(filepath.Join(wd, currentProjectFile))
+	if err == nil {
+		name := strings.TrimSpace(string(b))
+		for _, p := range projects {
+			if p == name {
+				return name, nil
+			}
+		}
+		log.Warn().Msgf("selected project %s not found", name)
+	}
+	switch len(projects) {
+	case 0:
+		return "", ConfigFileNotFound{Err: fmt.Errorf("no project found in %s", wd)}
+	case 1:
+		return projects[0], nil
+	default:
+		return "", fmt.Errorf("more than one project found (%s): please select one with --project or project use", strings.Join(projects, ", "))
+	}
+}
+
+// UseProject selects the project the commands act on when none is given explicitly.
+func UseProject(wd, name string) error {
+	if _, err := os.Stat(filepath.Join(wd, name, StateFile)); err != nil {
+		return ConfigFileNotFound{Err: err}
+	}
+	return os.WriteFile(filepath.Join(wd, currentProjectFile), []byte(name+"\n"), 0600)
+}
+
+// StatePath returns the path of the state file of the project.
+func (c *Config) StatePath() string {
+	return filepath.Join(c.Workdir, c.Name, StateFile)
+}
+
+// Delete removes the local files of the project, state included, and deselects it if it was the current one.
+func (c *Config) Delete() error {
+	if err := os.RemoveAll(c.WorkdirProject); err != nil {
+		return err
+	}
+	current := filepath.Join(c.Workdir, currentProjectFile)
+	b, err := os.ReadFile(current)
+	if err == nil && strings.TrimSpace(string(b)) == c.Name {
+		return os.Remove(current)
+	}
+	return nil
+}
+
+// migrateLegacyState moves the single state file used by previous versions (.caravan/caravan.state)
+// into the directory of its project.
+func migrateLegacyState(wd string) error {
+	legacy := filepath.Join(wd, StateFile)
+	b, err := os.ReadFile(legacy)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	c := struct{ Name string }{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return ConfigFileUnreadable{Err: err}
+	}
+	if c.Name == "" {
+		return ConfigFileUnreadable{Err: fmt.Errorf("missing project name in %s", legacy)}
+	}
+	if err := os.MkdirAll(filepath.Join(wd, c.Name), os.ModePerm); err != nil {
+		return err
+	}
+	log.Info().Msgf("moving %s to %s", legacy, filepath.Join(wd, c.Name, StateFile))
+	if err := os.Rename(legacy, filepath.Join(wd, c.Name, StateFile)); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(wd, currentProjectFile)); errors.Is(err, os.ErrNotExist) {
+		return os.WriteFile(filepath.Join(wd, currentProjectFile), []byte(c.Name+"\n"), 0600)
+	}
+	return nil
+}
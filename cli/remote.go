@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RemoteState gives access to a copy of the state file kept in the provider's state store.
+type RemoteState interface {
+	// PullState reads the remote copy of the state file and its version, which changes on each write.
+	PullState(context.Context) ([]byte, string, error)
+	// PushState replaces the remote copy of the state file provided that it is still at the given
+	// version, or that it does not exist when the version is empty, and returns the new version.
+	// RemoteStateConflict is returned when the remote copy changed meanwhile.
+	PushState(ctx context.Context, data []byte, version string) (string, error)
+}
+
+// SetRemoteState attaches the remote state store the configuration is synced with.
+func (c *Config) SetRemoteState(ctx context.Context, r RemoteState) {
+	c.remote = r
+	c.remoteCtx = ctx
+}
+
+// Pull reads the remote copy of the state file and replaces with it the configuration.
+func (c *Config) Pull() error {
+	remote, _, err := c.pull()
+	if err != nil {
+		return err
+	}
+	c.adopt(remote)
+	return c.write()
+}
+
+// Push replaces the remote copy of the state file with the configuration, whatever its content.
+// The serial is moved past the remote one, so that the other copies of the state adopt it.
+// The remote secrets are not opened, so that a copy sealed with another key is replaced as well.
+func (c *Config) Push() (err error) {
+	for i := 0; i < 3; i++ {
+		if err = c.pushOnce(); !errors.As(err, &RemoteStateConflict{}) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Config) pushOnce() error {
+	remote, version, err := c.pullSealed()
+	if err != nil && !errors.As(err, &RemoteStateNotFound{}) {
+		return err
+	}
+	if remote != nil && remote.Serial >= c.Serial {
+		c.Serial = remote.Serial + 1
+	}
+	_, err = c.push(version)
+	return err
+}
+
+// Sync brings the local and the remote state files in line. The copy that changed since they were
+// last in line is kept, and RemoteStateConflict is returned when both changed.
+func (c *Config) Sync() error {
+	_, err := c.sync()
+	return err
+}
+
+// sync is Sync returning the version of the remote copy once in line. A push failing on a concurrent
+// write is retried, as the write may be a renewal of the lease leaving the serial alone.
+func (c *Config) sync() (version string, err error) {
+	if c.remote == nil || !c.RemoteState {
+		return "", nil
+	}
+	for i := 0; i < 3; i++ {
+		if version, err = c.syncOnce(); !errors.As(err, &RemoteStateConflict{}) {
+			return version, err
+		}
+	}
+	return version, err
+}
+
+func (c *Config) syncOnce() (string, error) {
+	remote, version, err := c.pull()
+	if err != nil {
+		if errors.As(err, &RemoteStateNotFound{}) {
+			log.Info().Msgf("remote state of project %s not found: pushing local state", c.Name)
+			return c.push("")
+		}
+		return "", err
+	}
+
+	base := c.RemoteSerial
+	if base == 0 {
+		// states saved by previous versions do not record the last synced serial
+		base = c.Serial
+		if remote.Serial < base {
+			base = remote.Serial
+		}
+	}
+	localChanged, remoteChanged := c.Serial != base, remote.Serial != base
+	switch {
+	case localChanged && remoteChanged:
+		return "", RemoteStateConflict{Err: fmt.Errorf("local (serial %d) and remote (serial %d) states of project %s both changed since serial %d: %s",
+			c.Serial, remote.Serial, c.Name, base, conflictHint)}
+	case remoteChanged:
+		log.Info().Msgf("remote state of project %s is newer (serial %d, local %d): updating local state", c.Name, remote.Serial, c.Serial)
+		c.adopt(remote)
+		return version, c.write()
+	case localChanged:
+		log.Info().Msgf("local state of project %s is newer (serial %d, remote %d): updating remote state", c.Name, c.Serial, remote.Serial)
+		return c.push(version)
+	}
+	same, err := c.sameAs(remote)
+	if err != nil {
+		return "", err
+	}
+	if !same {
+		return "", RemoteStateConflict{Err: fmt.Errorf("local and remote states of project %s differ at the same serial %d: %s", c.Name, c.Serial, conflictHint)}
+	}
+	c.RemoteSerial = c.Serial
+	return version, nil
+}
+
+const conflictHint = "run state pull to discard the local changes or state push to overwrite the remote ones"
+
+// push writes the configuration to the remote copy still at the given version, records the serial
+// as synced in the local state file and returns the new version.
+func (c *Config) push(version string) (string, error) {
+	if c.remote == nil {
+		return "", errors.New("remote state store not available")
+	}
+	synced := c.RemoteSerial
+	c.RemoteSerial = c.Serial
+	data, err := c.marshal()
+	if err != nil {
+		c.RemoteSerial = synced
+		return "", err
+	}
+	version, err = c.remote.PushState(c.remoteCtx, data, version)
+	if err != nil {
+		c.RemoteSerial = synced
+		return "", err
+	}
+	return version, c.write()
+}
+
+func (c *Config) pull() (*Config, string, error) {
+	remote, version, err := c.pullSealed()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := remote.open(); err != nil {
+		return nil, "", ConfigFileUnreadable{Err: err}
+	}
+	return remote, version, nil
+}
+
+// pullSealed reads the remote copy of the state file leaving its secrets sealed.
+func (c *Config) pullSealed() (*Config, string, error) {
+	if c.remote == nil {
+		return nil, "", errors.New("remote state store not available")
+	}
+	data, version, err := c.remote.PullState(c.remoteCtx)
+	if err != nil {
+		return nil, "", err
+	}
+	if data, _, err = upgradeState(data); err != nil {
+		return nil, "", ConfigFileUnreadable{Err: err}
+	}
+	remote := &Config{}
+	if err := json.Unmarshal(data, remote); err != nil {
+		return nil, "", ConfigFileUnreadable{Err: err}
+	}
+	return remote, version, nil
+}
+
+// sameAs tells whether the persisted fields of the configuration, secrets in plain text, are the ones of r.
+func (c *Config) sameAs(r *Config) (bool, error) {
+	other := *c
+	other.adopt(r)
+	other.RemoteSerial = c.RemoteSerial
+	if other.Lease != nil && c.Lease != nil && other.Lease.heldBy(*c.Lease) {
+		// the renewal of the lease alone is not a change
+		other.Lease = c.Lease
+	}
+	a, err := json.Marshal(c)
+	if err != nil {
+		return false, err
+	}
+	b, err := json.Marshal(&other)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(a, b), nil
+}
+
+// adopt replaces the persisted fields of the configuration with the ones of r, keeping the runtime settings.
+func (c *Config) adopt(r *Config) {
+	logLevel, force, useSavedPlan := c.LogLevel, c.Force, c.UseSavedPlan
+	remote, remoteCtx, lease, stopRenewal := c.remote, c.remoteCtx, c.lease, c.stopRenewal
+	version, binary := c.TerraformVersion, c.TerraformBinary
+	*c = *r
+	c.LogLevel, c.Force, c.UseSavedPlan = logLevel, force, useSavedPlan
+	c.remote, c.remoteCtx, c.lease, c.stopRenewal = remote, remoteCtx, lease, stopRenewal
+	if c.TerraformVersion == version {
+		c.TerraformBinary = binary
+	}
+}
@@ -0,0 +1,154 @@
+package cli_test
+
+import (
+	"caravan-cli/cli"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type memoryState struct {
+	mu         sync.Mutex
+	data       []byte
+	generation int
+	// beforePush is called before each push, e.g. to simulate a concurrent write.
+	beforePush func(m *memoryState)
+}
+
+func (m *memoryState) PullState(ctx context.Context) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		return nil, "", cli.RemoteStateNotFound{Err: errors.New("empty")}
+	}
+	return m.data, strconv.Itoa(m.generation), nil
+}
+
+func (m *memoryState) PushState(ctx context.Context, data []byte, version string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.beforePush != nil {
+		m.beforePush(m)
+	}
+	current := ""
+	if m.data != nil {
+		current = strconv.Itoa(m.generation)
+	}
+	if version != current {
+		return "", cli.RemoteStateConflict{Err: fmt.Errorf("generation %s, not %s", current, version)}
+	}
+	m.data = data
+	m.generation++
+	return strconv.Itoa(m.generation), nil
+}
+
+// state returns the remote copy of the state.
+func (m *memoryState) state(t *testing.T) *cli.Config {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := &cli.Config{}
+	if err := json.Unmarshal(m.data, c); err != nil {
+		t.Fatalf("unable to read remote state: %s", err)
+	}
+	return c
+}
+
+func TestRemoteStateSync(t *testing.T) {
+	ctx := context.Background()
+	defer os.RemoveAll(cli.Workdir)
+	remote := &memoryState{}
+
+	c, err := cli.NewConfigFromScratch("name1", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatalf("unable to create config: %s\n", err)
+	}
+	c.RemoteState = true
+	c.SetRemoteState(ctx, remote)
+	c.SaveStatus(cli.InitDone)
+	if remote.data == nil {
+		t.Fatalf("state not pushed on status transition")
+	}
+
+	// a teammate progresses the project from another copy of the state
+	other, err := cli.NewConfigFromFile("name1")
+	if err != nil {
+		t.Fatalf("unable to load config: %s\n", err)
+	}
+	other.SetRemoteState(ctx, remote)
+	other.SaveStatus(cli.InfraDeployDone)
+
+	c.LogLevel = cli.LogLevelDebug
+	if err := c.Sync(); err != nil {
+		t.Fatalf("unable to sync: %s\n", err)
+	}
+	if c.Status != cli.InfraDeployDone {
+		t.Errorf("status not pulled: got %s want %s", c.Status, cli.InfraDeployDone)
+	}
+	if c.LogLevel != cli.LogLevelDebug {
+		t.Errorf("runtime settings overwritten by pull: got %s", c.LogLevel)
+	}
+	if c.Serial != other.Serial {
+		t.Errorf("serial mismatch: got %d want %d", c.Serial, other.Serial)
+	}
+}
+
+func TestRemoteStateConflict(t *testing.T) {
+	ctx := context.Background()
+	defer os.RemoveAll(cli.Workdir)
+	remote := &memoryState{}
+
+	c, err := cli.NewConfigFromScratch("name1", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatalf("unable to create config: %s\n", err)
+	}
+	c.RemoteState = true
+	c.SetRemoteState(ctx, remote)
+	c.SaveStatus(cli.InitDone)
+
+	other, err := cli.NewConfigFromFile("name1")
+	if err != nil {
+		t.Fatalf("unable to load config: %s\n", err)
+	}
+	other.SetRemoteState(ctx, remote)
+	other.SaveStatus(cli.InfraDeployDone)
+	pushed := remote.data
+
+	// the changes made meanwhile are neither dropped nor pushed over the ones of the teammate
+	c.Domain = "example.com"
+	c.SaveStatus(cli.InfraDeployRunning)
+	if string(remote.data) != string(pushed) {
+		t.Errorf("remote state overwritten by a diverged copy")
+	}
+	if c.Domain != "example.com" || c.Status != cli.InfraDeployRunning {
+		t.Errorf("local changes dropped: domain %q status %s", c.Domain, c.Status)
+	}
+	if err := c.Sync(); !errors.As(err, &cli.RemoteStateConflict{}) {
+		t.Errorf("diverged states: got %v want a conflict", err)
+	}
+
+	// the same serial with a different content is a conflict as well
+	if err := c.Pull(); err != nil {
+		t.Fatalf("unable to pull: %s\n", err)
+	}
+	c.Domain = "example.org"
+	if err := c.Sync(); !errors.As(err, &cli.RemoteStateConflict{}) {
+		t.Errorf("same serial and different content: got %v want a conflict", err)
+	}
+
+	// an explicit push overwrites the remote state and is adopted by the other copies
+	if err := c.Push(); err != nil {
+		t.Fatalf("unable to push: %s\n", err)
+	}
+	if err := other.Sync(); err != nil {
+		t.Fatalf("unable to sync: %s\n", err)
+	}
+	if other.Domain != "example.org" {
+		t.Errorf("pushed state not adopted: got domain %q", other.Domain)
+	}
+}
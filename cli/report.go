@@ -3,11 +3,17 @@ package cli
 import (
 	"caravan-cli/cli/checker"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 )
 
 type Target struct {
@@ -24,11 +30,26 @@ type Report struct {
 	Caravan *Config
 	Tools   map[string]Tool
 	Targets []string
+	// AcceptStandby reports the Vault standby nodes as available.
+	AcceptStandby bool
+	// Timeout bounds the check of each tool.
+	Timeout time.Duration
+	// ReadConsulToken reads a Consul token from Vault for the details of the cluster when the one of the
+	// project is missing or denied, e.g. because its lease expired.
+	ReadConsulToken bool
 }
 
+// DefaultCheckTimeout is the time each tool is given to answer the checks of the report.
+const DefaultCheckTimeout = 15 * time.Second
+
 type Tool struct {
 	Status  bool
 	Version string
+	Health  checker.HealthResult
+	Nomad   *checker.NomadDetails
+	Consul  *checker.ConsulDetails
+	// Errors are the errors met checking the tool.
+	Errors []string
 }
 
 func NewReport(c *Config) (r *Report) {
@@ -41,49 +62,169 @@ func NewReport(c *Config) (r *Report) {
 		Targets: targets,
 		Caravan: c,
 		Tools:   map[string]Tool{},
+		Timeout: DefaultCheckTimeout,
 	}
 	return r
 }
 
-func (r *Report) CheckStatus(ctx context.Context) (err error) {
+// CheckStatus checks the tools concurrently, each one within the Timeout of the report. The errors
+// are recorded in the tools, so that the report is complete when some of them are not reachable.
+func (r *Report) CheckStatus(ctx context.Context) {
+	r.Tools = r.checkAll(ctx, true)
+}
+
+// checkAll checks all the targets concurrently, reading the cluster details of the healthy ones
+// when details is set.
+func (r *Report) checkAll(ctx context.Context, details bool) map[string]Tool {
+	tools := map[string]Tool{}
 	// check CA for https
-	if _, err := os.Stat(r.Caravan.CAPath); os.IsNotExist(err) {
-		return nil
+	if _, err := os.Stat(r.Caravan.CAPath); err != nil {
+		for _, t := range r.Targets {
+			tools[t] = unreachable(fmt.Errorf("CA certificate not available: %w", err))
+		}
+		return tools
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, t := range r.Targets {
+		wg.Add(1)
+		go func(t string) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+			tool := r.checkTarget(cctx, t, details)
+			if err := cctx.Err(); err != nil && ctx.Err() == nil {
+				tool.Errors = append(tool.Errors, fmt.Sprintf("check not completed within %s", r.Timeout))
+			}
+			mu.Lock()
+			tools[t] = tool
+			mu.Unlock()
+		}(t)
+	}
+	wg.Wait()
+	return tools
+}
+
+// checkTarget checks the health of a target and, when details is set and it is healthy, reads its
+// cluster details.
+func (r *Report) checkTarget(ctx context.Context, t string, details bool) Tool {
+	h, err := r.checker(t)
+	if err != nil {
+		return unreachable(err)
 	}
+	tool := r.checkTool(ctx, h)
+	if details && tool.Status {
+		r.readDetails(ctx, h, &tool)
+	}
+	return tool
+}
+
+// unreachable returns a tool that could not be checked.
+func unreachable(err error) Tool {
+	return Tool{
+		Health: checker.HealthResult{State: checker.Unreachable, Reason: err.Error()},
+		Errors: []string{err.Error()},
+	}
+}
+
+// checker builds the checker of the given target.
+func (r *Report) checker(t string) (checker.Checker, error) {
 	dc := func(gc *checker.GenericChecker) {
 		gc.Datacenter = r.Caravan.Datacenter
 	}
-	for _, t := range r.Targets {
-		var h checker.Checker
-		switch t {
-		case Nomad:
-			h, err = checker.NewNomadChecker(fmt.Sprintf("https://%s.%s.%s", t, r.Caravan.Name, r.Caravan.Domain), r.Caravan.CAPath)
-			if err != nil {
-				return err
-			}
-		case Consul:
-			h, err = checker.NewConsulChecker(fmt.Sprintf("https://%s.%s.%s", t, r.Caravan.Name, r.Caravan.Domain), r.Caravan.CAPath, dc)
-			if err != nil {
-				return err
-			}
-		case Vault:
-			h, err = checker.NewVaultChecker(fmt.Sprintf("https://%s.%s.%s", t, r.Caravan.Name, r.Caravan.Domain), r.Caravan.CAPath)
-			if err != nil {
-				return err
-			}
-		default:
-			return fmt.Errorf("unsupported target")
+	switch t {
+	case Nomad:
+		nc, err := checker.NewNomadChecker(r.Caravan.Endpoint(t), r.Caravan.CAPath)
+		nc.Token = r.Caravan.NomadToken
+		return nc, err
+	case Consul:
+		cc, err := checker.NewConsulChecker(r.Caravan.Endpoint(t), r.Caravan.CAPath, dc)
+		cc.Token = r.Caravan.ConsulToken
+		return cc, err
+	case Vault:
+		vc, err := checker.NewVaultChecker(r.Caravan.Endpoint(t), r.Caravan.CAPath)
+		vc.AcceptStandby = r.AcceptStandby
+		return vc, err
+	default:
+		return nil, fmt.Errorf("unsupported target")
+	}
+}
+
+// readDetails reads the cluster details of the tools providing them.
+func (r *Report) readDetails(ctx context.Context, h checker.Checker, tool *Tool) {
+	var version string
+	var err error
+	switch c := h.(type) {
+	case checker.NomadChecker:
+		var d checker.NomadDetails
+		d, err = c.Details(ctx)
+		version, tool.Nomad = d.Version, &d
+	case checker.ConsulChecker:
+		var d checker.ConsulDetails
+		d, err = r.consulDetails(ctx, c)
+		version, tool.Consul = d.Version, &d
+	default:
+		return
+	}
+	if err != nil {
+		tool.Errors = append(tool.Errors, fmt.Sprintf("unable to read all the details: %s", err))
+	}
+	if version != "" {
+		tool.Version = version
+	}
+}
+
+// consulDetails reads the details of the Consul cluster, with a new token from Vault when the token of
+// the project is missing or denied and ReadConsulToken is set.
+func (r *Report) consulDetails(ctx context.Context, cc checker.ConsulChecker) (checker.ConsulDetails, error) {
+	// the token is read from vault at most once
+	read := false
+	if cc.Token == "" && r.ReadConsulToken {
+		t, err := r.Caravan.ReadConsulToken()
+		if err != nil {
+			log.Debug().Msgf("unable to read a consul token from vault: %s", err)
+		}
+		cc.Token, read = t, true
+	}
+	d, err := cc.Details(ctx)
+	se := checker.StatusError{}
+	if !r.ReadConsulToken || read || !errors.As(err, &se) || !se.Denied() {
+		return d, err
+	}
+	t, terr := r.Caravan.ReadConsulToken()
+	if terr != nil {
+		return d, fmt.Errorf("%w (unable to read a new consul token from vault: %s)", err, terr)
+	}
+	log.Debug().Msgf("consul token denied, reading the details with a new one")
+	cc.Token = t
+	return cc.Details(ctx)
+}
+
+// checkTool reads the health of a tool, using the structured health of the checkers providing it.
+func (r *Report) checkTool(ctx context.Context, h checker.Checker) Tool {
+	if hc, ok := h.(checker.HealthChecker); ok {
+		health := hc.Health(ctx)
+		version := health.Version
+		if version == "" && health.State != checker.Unreachable {
+			version = h.Version(ctx)
 		}
-		status := h.Status(ctx)
-		version := h.Version(ctx)
-		c := Tool{Status: status, Version: version}
-		r.Tools[t] = c
+		return Tool{Status: health.Ready(r.AcceptStandby), Version: version, Health: health}
+	}
+	start := time.Now()
+	t := Tool{Status: h.Status(ctx)}
+	t.Health.Latency = time.Since(start)
+	t.Health.State = checker.Healthy
+	if !t.Status {
+		t.Health.State = checker.Unhealthy
 	}
-	return nil
+	t.Version = h.Version(ctx)
+	return t
 }
 
 func (r *Report) PrintReport() {
-	t, err := template.New("status").Parse(`
+	funcs := template.FuncMap{"deref": func(b *bool) bool { return b != nil && *b }}
+	t, err := template.New("status").Funcs(funcs).Parse(`
 Name:		{{.Caravan.Name }}@{{or .Caravan.Branch "default"}}
 Status:		{{.Caravan.Status}}
 Provider:	{{.Caravan.Provider}} 
@@ -92,12 +233,46 @@ Domain:		{{ .Caravan.Domain }}
 DeployNomad:    {{ .Caravan.DeployNomad }}
 Linux Distro:   {{ .Caravan.LinuxOS }}-{{ .Caravan.LinuxOSVersion }}
 Licensing:      {{ .Caravan.Edition }}
+{{- if .Caravan.Layers }}
+Layers:
+{{- range $l, $s := .Caravan.Layers }}
+	{{ $l }}:	{{ $s.State }}{{ if $s.Interrupted }} (interrupted){{ end }}
+{{- if $s.LastApply }}	applied {{ $s.LastApply.Format "2006-01-02 15:04:05" }}{{ end }}
+{{- if $s.TerraformVersion }}	terraform {{ $s.TerraformVersion }}{{ end }}
+{{- if $s.Commit }}	commit {{ $s.Commit }}{{ end }}
+{{- if $s.LastError }}
+		error: {{ $s.LastError }}
+{{- end }}
+{{- end }}
+{{- end }}
 {{- if gt .Caravan.Status 3 }}
 {{ range $k,$v:= .Tools }}
 {{ $k }}
-	URL:		https://{{ $k }}.{{ $.Caravan.Name}}.{{ $.Caravan.Domain }}
-	Status:		{{ $v.Status}}
+	URL:		{{ $.Caravan.Endpoint $k }}
+	Status:		{{ $v.Status}}{{ if $v.Health.State }} ({{ $v.Health }}){{ end }}
 	Version:	{{ $v.Version}}
+{{- if $v.Health.ClusterName }}
+	Cluster:	{{ $v.Health.ClusterName }}
+{{- end }}
+{{- if $v.Health.Leader }}
+	Leader:		{{ $v.Health.Leader }}
+{{- end }}
+{{- with $v.Nomad }}
+	Region:		{{ .Region }}/{{ .Datacenter }}
+	Servers:	{{ .Servers }} ({{ .Peers }} raft peers)
+	Clients:	{{ .ReadyNodes }}/{{ .Nodes }} ready
+{{- end }}
+{{- with $v.Consul }}
+	Datacenter:	{{ .Datacenter }}
+	Servers:	{{ .Peers }} raft peers ({{ .Voters }} voters)
+{{- if .AutopilotHealthy }}
+	Autopilot:	{{ if deref .AutopilotHealthy }}healthy{{ else }}unhealthy{{ end }} (failure tolerance {{ .FailureTolerance }})
+{{- end }}
+	Connect CA:	{{ if .ConnectCAActive }}active{{ else }}no active root{{ end }} ({{ .ConnectCARoots }} roots)
+{{- end }}
+{{- range $v.Errors }}
+	Error:		{{ . }}
+{{- end }}
 {{- end }}
 {{- end }}
 `)
@@ -110,3 +285,145 @@ Licensing:      {{ .Caravan.Edition }}
 		log.Error().Msgf("error executing report: %s", err)
 	}
 }
+
+// StatusSchemaVersion is the version of the schema of StatusDocument. It is increased when a field is
+// removed or changes meaning, new fields may be added without increasing it.
+const StatusSchemaVersion = 1
+
+// StatusDocument is the machine-readable report of a project, as printed by PrintJSON and PrintYAML.
+type StatusDocument struct {
+	SchemaVersion int               `json:"schemaVersion" yaml:"schemaVersion"`
+	Project       *ProjectInfo      `json:"project,omitempty" yaml:"project,omitempty"`
+	Status        string            `json:"status" yaml:"status"`
+	Layers        []LayerInfo       `json:"layers" yaml:"layers"`
+	Tools         []ToolInfo        `json:"tools" yaml:"tools"`
+	Endpoints     map[string]string `json:"endpoints" yaml:"endpoints"`
+}
+
+// ProjectInfo holds the metadata of the project.
+type ProjectInfo struct {
+	Name         string `json:"name" yaml:"name"`
+	Provider     string `json:"provider" yaml:"provider"`
+	Region       string `json:"region" yaml:"region"`
+	Domain       string `json:"domain" yaml:"domain"`
+	Branch       string `json:"branch" yaml:"branch"`
+	LinuxDistro  string `json:"linuxDistro" yaml:"linuxDistro"`
+	Edition      string `json:"edition" yaml:"edition"`
+	DeployNomad  bool   `json:"deployNomad" yaml:"deployNomad"`
+	RemoteState  bool   `json:"remoteState" yaml:"remoteState"`
+	Datacenter   string `json:"datacenter,omitempty" yaml:"datacenter,omitempty"`
+	LoadBalancer string `json:"loadBalancer,omitempty" yaml:"loadBalancer,omitempty"`
+}
+
+// LayerInfo holds the state of a stack layer.
+type LayerInfo struct {
+	Name             string     `json:"name" yaml:"name"`
+	State            string     `json:"state" yaml:"state"`
+	Interrupted      bool       `json:"interrupted" yaml:"interrupted"`
+	LastApply        *time.Time `json:"lastApply,omitempty" yaml:"lastApply,omitempty"`
+	TerraformVersion string     `json:"terraformVersion,omitempty" yaml:"terraformVersion,omitempty"`
+	Commit           string     `json:"commit,omitempty" yaml:"commit,omitempty"`
+	LastError        string     `json:"lastError,omitempty" yaml:"lastError,omitempty"`
+}
+
+// ToolInfo holds the health and version of a tool. Checked is false when the tool was not
+// checked, as it happens before the infra layer is deployed.
+type ToolInfo struct {
+	Name     string `json:"name" yaml:"name"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Checked  bool   `json:"checked" yaml:"checked"`
+	Healthy  bool   `json:"healthy" yaml:"healthy"`
+	Version  string `json:"version,omitempty" yaml:"version,omitempty"`
+	// State is one of healthy, standby, perfstandby, sealed, uninitialized, unhealthy and unreachable.
+	State       string `json:"state,omitempty" yaml:"state,omitempty"`
+	Reason      string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	LatencyMS   int64  `json:"latencyMs,omitempty" yaml:"latencyMs,omitempty"`
+	Leader      string `json:"leader,omitempty" yaml:"leader,omitempty"`
+	ClusterName string `json:"clusterName,omitempty" yaml:"clusterName,omitempty"`
+	// Nomad holds the details of the Nomad cluster.
+	Nomad *checker.NomadDetails `json:"nomad,omitempty" yaml:"nomad,omitempty"`
+	// Consul holds the details of the Consul cluster.
+	Consul *checker.ConsulDetails `json:"consul,omitempty" yaml:"consul,omitempty"`
+	// Errors are the errors met checking the tool.
+	Errors []string `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// MissingStatusDocument returns the document of a project that is not initialized.
+func MissingStatusDocument() StatusDocument {
+	return StatusDocument{
+		SchemaVersion: StatusSchemaVersion,
+		Status:        InitMissing.Name(),
+		Layers:        []LayerInfo{},
+		Tools:         []ToolInfo{},
+		Endpoints:     map[string]string{},
+	}
+}
+
+// Document returns the machine-readable report.
+func (r *Report) Document() StatusDocument {
+	c := r.Caravan
+	d := MissingStatusDocument()
+	d.Status = c.Status.Name()
+	d.Project = &ProjectInfo{
+		Name:         c.Name,
+		Provider:     c.Provider,
+		Region:       c.Region,
+		Domain:       c.Domain,
+		Branch:       c.Branch,
+		LinuxDistro:  c.LinuxOS + "-" + c.LinuxOSVersion,
+		Edition:      c.Edition,
+		DeployNomad:  c.DeployNomad,
+		RemoteState:  c.RemoteState,
+		Datacenter:   c.Datacenter,
+		LoadBalancer: c.LoadBalancerDNS,
+	}
+	for _, l := range Layers {
+		ls := c.Layer(l)
+		d.Layers = append(d.Layers, LayerInfo{
+			Name:             l.String(),
+			State:            ls.State.String(),
+			Interrupted:      ls.Interrupted,
+			LastApply:        ls.LastApply,
+			TerraformVersion: ls.TerraformVersion,
+			Commit:           ls.Commit,
+			LastError:        ls.LastError,
+		})
+	}
+	for _, t := range r.Targets {
+		tool, checked := r.Tools[t]
+		d.Tools = append(d.Tools, ToolInfo{
+			Name:        t,
+			Endpoint:    c.Endpoint(t),
+			Checked:     checked,
+			Healthy:     tool.Status,
+			Version:     tool.Version,
+			State:       string(tool.Health.State),
+			Reason:      tool.Health.Reason,
+			LatencyMS:   tool.Health.Latency.Milliseconds(),
+			Leader:      tool.Health.Leader,
+			ClusterName: tool.Health.ClusterName,
+			Nomad:       tool.Nomad,
+			Consul:      tool.Consul,
+			Errors:      tool.Errors,
+		})
+		d.Endpoints[t] = c.Endpoint(t)
+	}
+	return d
+}
+
+// PrintJSON writes the report as a JSON document.
+func (d StatusDocument) PrintJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(d)
+}
+
+// PrintYAML writes the report as a YAML document.
+func (d StatusDocument) PrintYAML(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(d); err != nil {
+		return err
+	}
+	return e.Close()
+}
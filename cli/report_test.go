@@ -0,0 +1,198 @@
+package cli_test
+
+import (
+	"bytes"
+	"caravan-cli/cli"
+	"caravan-cli/cli/checker"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestStatusDocument(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDomain("example.com")
+	c.SetStatus(cli.PlatformDeployDone)
+	r := cli.NewReport(c)
+	r.Tools[cli.Vault] = cli.Tool{Status: true, Version: "1.13.2"}
+
+	var b bytes.Buffer
+	if err := r.Document().PrintJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	got := cli.StatusDocument{}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON document: %s\n%s", err, b.String())
+	}
+	if got.SchemaVersion != cli.StatusSchemaVersion || got.Status != "PlatformDeployDone" || got.Project == nil || got.Project.Name != "name" {
+		t.Errorf("unexpected document: %s", b.String())
+	}
+	if len(got.Layers) != 3 || got.Layers[0].State != "Ready" || got.Layers[1].State != "Applied" || got.Layers[2].State != "Pending" {
+		t.Errorf("unexpected layers: %+v", got.Layers)
+	}
+	if len(got.Tools) != 2 || !got.Tools[0].Checked || !got.Tools[0].Healthy || got.Tools[0].Version != "1.13.2" || got.Tools[1].Checked {
+		t.Errorf("unexpected tools: %+v", got.Tools)
+	}
+	if got.Endpoints[cli.Consul] != "https://consul.name.example.com" {
+		t.Errorf("unexpected endpoints: %v", got.Endpoints)
+	}
+
+	b.Reset()
+	if err := r.Document().PrintYAML(&b); err != nil {
+		t.Fatal(err)
+	}
+	ygot := cli.StatusDocument{}
+	if err := yaml.Unmarshal(b.Bytes(), &ygot); err != nil {
+		t.Fatalf("invalid YAML document: %s\n%s", err, b.String())
+	}
+	if ygot.Status != got.Status || !strings.Contains(b.String(), "schemaVersion: 1") {
+		t.Errorf("unexpected YAML document:\n%s", b.String())
+	}
+}
+
+func TestToolChanges(t *testing.T) {
+	now := time.Now()
+	targets := []string{cli.Vault, cli.Consul}
+	sealed := cli.Tool{Health: checker.HealthResult{State: checker.Sealed, Reason: "the node must be unsealed"}}
+	active := cli.Tool{Status: true, Version: "1.13.2", Health: checker.HealthResult{State: checker.Healthy}}
+
+	changes := cli.ToolChanges(targets, nil, map[string]cli.Tool{cli.Vault: sealed}, now)
+	if len(changes) != 1 || changes[0].From != "" || changes[0].To != "sealed" || changes[0].Reason == "" {
+		t.Errorf("unexpected first changes %+v", changes)
+	}
+
+	prev := map[string]cli.Tool{cli.Vault: sealed, cli.Consul: active}
+	cur := map[string]cli.Tool{cli.Vault: active, cli.Consul: active}
+	changes = cli.ToolChanges(targets, prev, cur, now)
+	if len(changes) != 1 || changes[0].Tool != cli.Vault || changes[0].From != "sealed" || changes[0].To != "healthy" || !changes[0].Healthy {
+		t.Errorf("unexpected changes %+v", changes)
+	}
+
+	if changes := cli.ToolChanges(targets, cur, cur, now); len(changes) != 0 {
+		t.Errorf("unexpected changes without transitions %+v", changes)
+	}
+}
+
+func TestCheckStatusPartial(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	vault := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"initialized": true, "sealed": false, "version": "1.13.2"}`)
+	}))
+	defer vault.Close()
+	release := make(chan struct{})
+	consul := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer consul.Close()
+	defer close(release)
+	nomad := httptest.NewTLSServer(http.NotFoundHandler())
+	nomad.Close()
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeployNomad = true
+	c.VaultURL, c.ConsulURL, c.NomadURL = vault.URL, consul.URL, nomad.URL
+	c.CAPath = filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: vault.Certificate().Raw})
+	if err := os.WriteFile(c.CAPath, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := cli.NewReport(c)
+	r.Timeout = 200 * time.Millisecond
+	start := time.Now()
+	r.CheckStatus(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("checks took %s", elapsed)
+	}
+
+	if v := r.Tools[cli.Vault]; !v.Status || v.Version != "1.13.2" || len(v.Errors) != 0 {
+		t.Errorf("unexpected vault %+v", v)
+	}
+	if c := r.Tools[cli.Consul]; c.Status || len(c.Errors) == 0 || !strings.Contains(c.Errors[len(c.Errors)-1], "not completed within 200ms") {
+		t.Errorf("unexpected consul %+v", c)
+	}
+	if n := r.Tools[cli.Nomad]; n.Status || n.Health.State != checker.Unreachable {
+		t.Errorf("unexpected nomad %+v", n)
+	}
+	if d := r.Document(); len(d.Tools) != 3 {
+		t.Errorf("incomplete report %+v", d.Tools)
+	}
+}
+
+func TestCheckStatusConsulToken(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+
+	issued := 0
+	vault := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/consul/creds/reader" {
+			issued++
+			fmt.Fprint(w, `{"data": {"token": "new"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"initialized": true, "sealed": false, "version": "1.13.2"}`)
+	}))
+	defer vault.Close()
+	consul := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/status/leader":
+			fmt.Fprint(w, `"10.0.0.1:8300"`)
+		case r.Header.Get("X-Consul-Token") != "new":
+			http.Error(w, "ACL not found", http.StatusForbidden)
+		case r.URL.Path == "/v1/agent/self":
+			fmt.Fprint(w, `{"Config": {"Datacenter": "dc1", "Version": "1.15.2"}}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer consul.Close()
+
+	c, err := cli.NewConfigFromScratch("name", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeployNomad = false
+	c.VaultURL, c.ConsulURL = vault.URL, consul.URL
+	c.CAPath = filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: vault.Certificate().Raw})
+	if err := os.WriteFile(c.CAPath, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+	c.ConsulTokenRole = "reader"
+
+	for _, token := range []string{"", "expired"} {
+		c.ConsulToken = token
+		issued = 0
+		r := cli.NewReport(c)
+		r.ReadConsulToken = true
+		r.CheckStatus(context.Background())
+		tool := r.Tools[cli.Consul]
+		if tool.Consul == nil || tool.Consul.Version != "1.15.2" || len(tool.Errors) != 0 {
+			t.Errorf("token %q: details not read with a new token: %+v", token, tool)
+		}
+		if issued != 1 {
+			t.Errorf("token %q: got %d tokens issued but wanted one", token, issued)
+		}
+	}
+}
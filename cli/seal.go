@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// EnvStatePassphrase is the environment variable holding the passphrase used to seal the state secrets.
+	EnvStatePassphrase = "CARAVAN_STATE_PASSPHRASE"
+	// EnvStateKeyFile is the environment variable holding the path of the key file used to seal the state secrets.
+	EnvStateKeyFile = "CARAVAN_STATE_KEY_FILE"
+
+	// A sealed value is the prefix followed by its format. The only format is "age:", followed by the
+	// base64 encoded age file (https://age-encryption.org/v1) holding the value, which carries its own
+	// version in the header. Other formats, if ever needed, get a new name and the existing ones stay readable.
+	sealedPrefix = "caravan:sealed:"
+	sealedAge    = sealedPrefix + "age:"
+
+	// scryptWorkFactor is lower than the age default, as each secret of the state is sealed on its own.
+	scryptWorkFactor = 15
+)
+
+// Sealer seals and opens the sensitive values persisted in the state file.
+type Sealer interface {
+	Seal(plaintext string) (string, error)
+	Open(sealed string) (string, error)
+}
+
+var (
+	sealer     Sealer
+	warnSealer sync.Once
+)
+
+// UseSealer sets the sealer used to persist and load the state files, nil disables sealing.
+func UseSealer(s Sealer) {
+	sealer = s
+}
+
+// SealerFromEnv returns the sealer configured by the environment, with the key file taking precedence
+// over the passphrase. It returns nil when none is configured.
+func SealerFromEnv(keyFile string) (Sealer, error) {
+	if keyFile == "" {
+		keyFile = os.Getenv(EnvStateKeyFile)
+	}
+	if keyFile != "" {
+		return NewKeyFileSealer(keyFile)
+	}
+	if p := os.Getenv(EnvStatePassphrase); p != "" {
+		return NewPassphraseSealer(p)
+	}
+	return nil, nil
+}
+
+// IsSealed reports whether the value was produced by a Sealer.
+func IsSealed(v string) bool {
+	return strings.HasPrefix(v, sealedPrefix)
+}
+
+// PassphraseSealer seals with an age scrypt recipient. As scrypt is slow by design, the values sealed
+// or opened are remembered, so that saving the state again does not derive the keys again.
+type PassphraseSealer struct {
+	recipient *age.ScryptRecipient
+	identity  *age.ScryptIdentity
+	sealed    map[string]string
+	opened    map[string]string
+	mu        sync.Mutex
+}
+
+func NewPassphraseSealer(passphrase string) (*PassphraseSealer, error) {
+	r, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(scryptWorkFactor)
+	i, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &PassphraseSealer{recipient: r, identity: i, sealed: map[string]string{}, opened: map[string]string{}}, nil
+}
+
+func (s *PassphraseSealer) Seal(plaintext string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.sealed[plaintext]; ok {
+		return v, nil
+	}
+	v, err := seal(plaintext, s.recipient)
+	if err != nil {
+		return "", err
+	}
+	s.sealed[plaintext], s.opened[v] = v, plaintext
+	return v, nil
+}
+
+func (s *PassphraseSealer) Open(sealed string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.opened[sealed]; ok {
+		return v, nil
+	}
+	v, err := open(sealed, s.identity)
+	if err != nil {
+		return "", err
+	}
+	s.sealed[v], s.opened[sealed] = sealed, v
+	return v, nil
+}
+
+// KeySealer seals with the age X25519 identity stored in a key file, in the format of age-keygen.
+type KeySealer struct {
+	identity *age.X25519Identity
+}
+
+// NewKeyFileSealer reads the identity from the given file, generating it when the file does not exist.
+func NewKeyFileSealer(path string) (*KeySealer, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info().Msgf("generating state key file %s", path)
+		return GenerateKeyFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key file %s: %w", path, err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	for _, i := range ids {
+		if x, ok := i.(*age.X25519Identity); ok {
+			return &KeySealer{identity: x}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid key file %s: an age X25519 identity is expected", path)
+}
+
+// GenerateKeyFile writes a new age X25519 identity to the given file.
+func GenerateKeyFile(path string) (*KeySealer, error) {
+	i, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, err
+	}
+	data := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), i.Recipient(), i)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		return nil, fmt.Errorf("unable to write key file %s: %w", path, err)
+	}
+	return &KeySealer{identity: i}, nil
+}
+
+func (s *KeySealer) Seal(plaintext string) (string, error) {
+	return seal(plaintext, s.identity.Recipient())
+}
+
+func (s *KeySealer) Open(sealed string) (string, error) {
+	return open(sealed, s.identity)
+}
+
+func seal(plaintext string, r age.Recipient) (string, error) {
+	var b bytes.Buffer
+	w, err := age.Encrypt(&b, r)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return sealedAge + base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+func open(sealed string, i age.Identity) (string, error) {
+	if !strings.HasPrefix(sealed, sealedAge) {
+		return "", errors.New("unsupported sealed value format")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedAge))
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed value: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(b), i)
+	if err != nil {
+		return "", errors.New("unable to open sealed value: wrong key or passphrase")
+	}
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("unable to open sealed value: %w", err)
+	}
+	return string(p), nil
+}
+
+// Reseal switches to the given sealer and saves the state with the secrets sealed by it. The remote
+// copy, still sealed with the previous key, is replaced whatever its content.
+func (c *Config) Reseal(s Sealer) error {
+	UseSealer(s)
+	c.renew()
+	c.Serial++
+	if err := c.write(); err != nil {
+		return err
+	}
+	if c.remote == nil || !c.RemoteState {
+		return nil
+	}
+	if err := c.Push(); err != nil {
+		return fmt.Errorf("unable to push state of project %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+// secrets returns the sensitive fields of the configuration.
+func (c *Config) secrets() []*string {
+	return []*string{
+		&c.VaultRootToken,
+		&c.NomadToken,
+		&c.ConsulToken,
+		&c.AzureClientSecret,
+		&c.AzureBakingClientSecret,
+	}
+}
+
+// sealed returns a copy of the configuration with the sensitive fields sealed.
+func (c *Config) sealed() (*Config, error) {
+	cp := *c
+	if sealer == nil {
+		warnSealer.Do(func() {
+			log.Warn().Msgf("state secrets stored in plain text: set %s or %s to seal them", EnvStatePassphrase, EnvStateKeyFile)
+		})
+		return &cp, nil
+	}
+	for _, s := range cp.secrets() {
+		if *s == "" || IsSealed(*s) {
+			continue
+		}
+		v, err := sealer.Seal(*s)
+		if err != nil {
+			return nil, fmt.Errorf("unable to seal state: %w", err)
+		}
+		*s = v
+	}
+	return &cp, nil
+}
+
+// open replaces the sealed sensitive fields with their plain text value.
+func (c *Config) open() error {
+	for _, s := range c.secrets() {
+		if !IsSealed(*s) {
+			continue
+		}
+		if sealer == nil {
+			return fmt.Errorf("state of project %s is sealed: set %s or %s", c.Name, EnvStatePassphrase, EnvStateKeyFile)
+		}
+		v, err := sealer.Open(*s)
+		if err != nil {
+			return err
+		}
+		*s = v
+	}
+	return nil
+}
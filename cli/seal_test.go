@@ -0,0 +1,137 @@
+package cli_test
+
+import (
+	"caravan-cli/cli"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealers(t *testing.T) {
+	dir := t.TempDir()
+	ps, err := cli.NewPassphraseSealer("secret passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := cli.NewKeyFileSealer(filepath.Join(dir, "caravan.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "caravan.key")); !strings.Contains(string(b), "AGE-SECRET-KEY-") {
+		t.Errorf("key file not in the age format:\n%s", b)
+	}
+	reloaded, err := cli.NewKeyFileSealer(filepath.Join(dir, "caravan.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := cli.NewPassphraseSealer("another passphrase")
+
+	for name, s := range map[string]cli.Sealer{"passphrase": ps, "key file": ks} {
+		t.Run(name, func(t *testing.T) {
+			sealed, err := s.Seal("s.token")
+			if err != nil {
+				t.Fatalf("unable to seal: %s", err)
+			}
+			if !cli.IsSealed(sealed) || strings.Contains(sealed, "s.token") {
+				t.Errorf("value not sealed: %s", sealed)
+			}
+			got, err := s.Open(sealed)
+			if err != nil || got != "s.token" {
+				t.Errorf("got %s (%v) but wanted %s", got, err, "s.token")
+			}
+			if _, err := other.Open(sealed); err == nil {
+				t.Errorf("value opened with the wrong key")
+			}
+		})
+	}
+
+	sealed, _ := ks.Seal("s.token")
+	if got, err := reloaded.Open(sealed); err != nil || got != "s.token" {
+		t.Errorf("key file not reloaded: got %s (%v)", got, err)
+	}
+}
+
+func TestSealedState(t *testing.T) {
+	defer os.RemoveAll(cli.Workdir)
+	defer cli.UseSealer(nil)
+
+	c, err := cli.NewConfigFromScratch("name1", "azure", "westeurope")
+	if err != nil {
+		t.Fatalf("unable to create config: %s\n", err)
+	}
+	c.VaultRootToken = "s.root"
+	c.AzureClientSecret = "azure-secret"
+	c.Save()
+
+	// plain text state files keep working
+	s, _ := cli.NewPassphraseSealer("secret passphrase")
+	cli.UseSealer(s)
+	c, err = cli.NewConfigFromFile("name1")
+	if err != nil {
+		t.Fatalf("unable to load plain text state: %s\n", err)
+	}
+	c.Save()
+
+	b, err := os.ReadFile(c.StatePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s.root") || strings.Contains(string(b), "azure-secret") {
+		t.Errorf("secrets not sealed on save:\n%s", b)
+	}
+
+	c, err = cli.NewConfigFromFile("name1")
+	if err != nil {
+		t.Fatalf("unable to load sealed state: %s\n", err)
+	}
+	if c.VaultRootToken != "s.root" || c.AzureClientSecret != "azure-secret" {
+		t.Errorf("secrets not opened: got %s %s", c.VaultRootToken, c.AzureClientSecret)
+	}
+
+	cli.UseSealer(nil)
+	if _, err := cli.NewConfigFromFile("name1"); err == nil {
+		t.Errorf("sealed state loaded without key")
+	}
+}
+
+func TestResealRemoteState(t *testing.T) {
+	ctx := context.Background()
+	defer os.RemoveAll(cli.Workdir)
+	defer cli.UseSealer(nil)
+	remote := &memoryState{}
+
+	old, _ := cli.NewPassphraseSealer("old passphrase")
+	cli.UseSealer(old)
+	c, err := cli.NewConfigFromScratch("name1", "aws", "eu-south-1")
+	if err != nil {
+		t.Fatalf("unable to create config: %s\n", err)
+	}
+	c.VaultRootToken = "s.root"
+	c.RemoteState = true
+	c.SetRemoteState(ctx, remote)
+	c.SaveStatus(cli.InitDone)
+
+	s, _ := cli.NewPassphraseSealer("new passphrase")
+	if err := c.Reseal(s); err != nil {
+		t.Fatalf("unable to reseal: %s\n", err)
+	}
+	if got := remote.state(t); got.Serial != c.Serial {
+		t.Errorf("remote state not pushed: got serial %d want %d", got.Serial, c.Serial)
+	}
+
+	// both copies are opened by the new key only
+	other, err := cli.NewConfigFromFile("name1")
+	if err != nil {
+		t.Fatalf("unable to load resealed state: %s\n", err)
+	}
+	other.SetRemoteState(ctx, remote)
+	if err := other.Pull(); err != nil || other.VaultRootToken != "s.root" {
+		t.Errorf("remote state not opened with the new key: got %q (%v)", other.VaultRootToken, err)
+	}
+	cli.UseSealer(old)
+	if err := other.Pull(); err == nil {
+		t.Errorf("remote state opened with the old key")
+	}
+}
@@ -1,6 +1,8 @@
 package cli
 
-import "fmt"
+import (
+	"fmt"
+)
 
 type Status int
 
@@ -27,27 +29,64 @@ const (
 	ApplicationDeployDone
 )
 
+// statusNames are the names the statuses are persisted with: they must never change.
+var statusNames = map[Status]string{
+	InitMissing:                 "InitMissing",
+	InitRunning:                 "InitRunning",
+	InitDone:                    "InitDone",
+	BakingDone:                  "BakingDone",
+	InfraCleanDone:              "InfraCleanDone",
+	InfraCleanRunning:           "InfraCleanRunning",
+	InfraDeployRunning:          "InfraDeployRunning",
+	InfraDeployDone:             "InfraDeployDone",
+	InfraCheckRunning:           "InfraCheckRunning",
+	InfraCheckDone:              "InfraCheckDone",
+	PlatformCleanDone:           "PlatformCleanDone",
+	PlatformCleanRunning:        "PlatformCleanRunning",
+	PlatformDeployRunning:       "PlatformDeployRunning",
+	PlatformDeployDone:          "PlatformDeployDone",
+	PlatformConsulDeployRunning: "PlatformConsulDeployRunning",
+	PlatformConsulDeployDone:    "PlatformConsulDeployDone",
+	ApplicationCleanDone:        "ApplicationCleanDone",
+	ApplicationCleanRunning:     "ApplicationCleanRunning",
+	ApplicationDeployRunning:    "ApplicationDeployRunning",
+	ApplicationDeployDone:       "ApplicationDeployDone",
+}
+
+// Name returns the name the status is persisted with.
+func (s Status) Name() string {
+	if n, ok := statusNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("Unknown(%d)", int(s))
+}
+
 func (s Status) String() string {
-	return [...]string{
-		fmt.Sprintf("%d-InitMissing", s),
-		fmt.Sprintf("%d-InitRunning", s),
-		fmt.Sprintf("%d-InitDone", s),
-		fmt.Sprintf("%d-BakingDone", s),
-		fmt.Sprintf("%d-InfraCleanDone", s),
-		fmt.Sprintf("%d-InfraCleanRunning", s),
-		fmt.Sprintf("%d-InfraDeployRunning", s),
-		fmt.Sprintf("%d-InfraDeployDone", s),
-		fmt.Sprintf("%d-InfraCheckRunning", s),
-		fmt.Sprintf("%d-InfraCheckDone", s),
-		fmt.Sprintf("%d-PlatformCleanDone", s),
-		fmt.Sprintf("%d-PlatformCleanRunning", s),
-		fmt.Sprintf("%d-PlatformDeployRunning", s),
-		fmt.Sprintf("%d-PlatformDeployDone", s),
-		fmt.Sprintf("%d-PlatformConsulDeployRunning", s),
-		fmt.Sprintf("%d-PlatformConsulDeployDone", s),
-		fmt.Sprintf("%d-ApplicationCleanDone", s),
-		fmt.Sprintf("%d-ApplicationCleanRunning", s),
-		fmt.Sprintf("%d-ApplicationDeployRunning", s),
-		fmt.Sprintf("%d-ApplicationDeployDone", s),
-	}[s]
+	return fmt.Sprintf("%d-%s", s, s.Name())
+}
+
+// ParseStatus returns the status with the given name.
+func ParseStatus(name string) (Status, error) {
+	for s, n := range statusNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return InitMissing, fmt.Errorf("unknown status: %s", name)
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	if _, ok := statusNames[s]; !ok {
+		return nil, fmt.Errorf("unknown status: %d", int(s))
+	}
+	return []byte(s.Name()), nil
+}
+
+func (s *Status) UnmarshalText(b []byte) error {
+	v, err := ParseStatus(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
 }
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"time"
+)
+
+// ToolChange is a transition of the health of a tool seen between two polls.
+type ToolChange struct {
+	Time time.Time `json:"time"`
+	Tool string    `json:"tool"`
+	// From is the previous state, empty the first time the tool is checked.
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+	Healthy   bool   `json:"healthy"`
+	Version   string `json:"version,omitempty"`
+	LatencyMS int64  `json:"latencyMs"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Poll checks the health of the targets concurrently and returns the tools, without the cluster
+// details read by CheckStatus.
+func (r *Report) Poll(ctx context.Context) map[string]Tool {
+	return r.checkAll(ctx, false)
+}
+
+// ToolChanges returns the tools whose state, health or version changed between two polls, in the
+// order of the targets.
+func ToolChanges(targets []string, prev, cur map[string]Tool, now time.Time) []ToolChange {
+	var changes []ToolChange
+	for _, t := range targets {
+		c, ok := cur[t]
+		if !ok {
+			continue
+		}
+		p, seen := prev[t]
+		if seen && p.Health.State == c.Health.State && p.Status == c.Status && p.Version == c.Version {
+			continue
+		}
+		change := ToolChange{
+			Time:      now,
+			Tool:      t,
+			To:        string(c.Health.State),
+			Healthy:   c.Status,
+			Version:   c.Version,
+			LatencyMS: c.Health.Latency.Milliseconds(),
+			Reason:    c.Health.Reason,
+		}
+		if seen {
+			change.From = string(p.Health.State)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
@@ -6,6 +6,7 @@ package cmd
 import (
 	"caravan-cli/cli"
 	"caravan-cli/git"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,6 +22,9 @@ var bakeCmd = &cobra.Command{
 	Short: "Generate (bake) up to date VM images for caravan",
 	Long:  `Baked images are available for usage in the selected provider's registry provided region.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := requireProject(); err != nil {
+			return err
+		}
 		_, err := cli.NewConfigFromScratch(name, prv, region)
 		if err != nil {
 			return fmt.Errorf("error generating config: %w", err)
@@ -35,6 +39,15 @@ var bakeCmd = &cobra.Command{
 			return err
 		}
 		c.LogLevel = logLevel
+		unlock, err := lockBake(c)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		c.TerraformVersion = terraformVersion
+		if err := setUpTerraform(c); err != nil {
+			return err
+		}
 		p, err := getProvider(ctx, c)
 		if err != nil {
 			return err
@@ -70,15 +83,40 @@ var bakeCmd = &cobra.Command{
 	},
 }
 
+// lockBake acquires the lease of the project for bake. The lease is recorded in the state of the project
+// when it exists, as the configuration baked from scratch must not replace it, and in a state removed on
+// unlock otherwise.
+func lockBake(c *cli.Config) (unlock func(), err error) {
+	l, err := cli.NewConfigFromFile(c.Name)
+	fresh := errors.As(err, &cli.ConfigFileNotFound{})
+	switch {
+	case fresh:
+		l = c
+	case err != nil:
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	l.LogLevel = c.LogLevel
+	if err := lockProject(l, "bake", false); err != nil {
+		return nil, err
+	}
+	return func() {
+		unlockProject(l)
+		if fresh {
+			if err := os.Remove(l.StatePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Warn().Msgf("unable to remove state file %s: %s", l.StatePath(), err)
+			}
+		}
+	}, nil
+}
+
 func init() {
 	rootCmd.AddCommand(bakeCmd)
 
-	bakeCmd.Flags().StringVarP(&name, FlagProject, FlagProjectShort, "", "name of project")
 	bakeCmd.Flags().StringVarP(&prv, FlagProvider, FlagProviderShort, "", "cloud provider")
 	bakeCmd.Flags().StringVarP(&distro, FlagLinuxDistro, FlagLinuxDistroShort, "centos7", "linux distribution")
 	bakeCmd.Flags().StringVarP(&region, FlagRegion, FlagRegionShort, "", "optional: override default profile region")
 	bakeCmd.Flags().StringVarP(&branch, FlagBranch, FlagBranchShort, "main", "optional: define a branch to checkout instead of default")
+	bakeCmd.Flags().StringVar(&terraformVersion, FlagTerraformVersion, cli.DefaultTerraformVersion, "terraform version to install and run, empty to use the terraform in $PATH")
 
-	_ = bakeCmd.MarkFlagRequired(FlagProject)
 	_ = bakeCmd.MarkFlagRequired(FlagProvider)
 }
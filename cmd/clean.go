@@ -7,7 +7,6 @@ import (
 	"caravan-cli/cli"
 	"errors"
 	"fmt"
-	"os"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -20,7 +19,7 @@ var cleanCmd = &cobra.Command{
 	Long:  `Deletion of the config files and supporting state stores/locking for terraform created during either up or init.`,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
 		var c *cli.Config
-		c, err = cli.NewConfigFromFile()
+		c, err = cli.NewConfigFromFile(name)
 		if err != nil {
 			if errors.As(err, &cli.ConfigFileNotFound{}) {
 				log.Info().Msgf("all clean")
@@ -32,55 +31,71 @@ var cleanCmd = &cobra.Command{
 		if force {
 			c.Force = true
 		}
+		layers, selected, err := selectLayers(layerNames, fromLayer, toLayer, true)
+		if err != nil {
+			return err
+		}
 		log.Info().Msgf("running clean on project %s", c.Name)
 
-		if c.Status == cli.InitMissing {
-			os.RemoveAll(c.WorkdirProject)
-			os.RemoveAll(c.Workdir + "/caravan.state")
-			return nil
+		if c.Status == cli.InitMissing && !selected {
+			if err := lockProject(c, "clean", false); err != nil {
+				return err
+			}
+			defer unlockProject(c)
+			return c.Delete()
+		}
+		clean := map[cli.DeployLayer]bool{}
+		for _, l := range layers {
+			clean[l] = true
+		}
+		for _, l := range layers {
+			for _, above := range cli.Layers[l+1:] {
+				if !clean[above] && c.Layer(above).State.Deployed() {
+					return fmt.Errorf("layer %s is deployed on top of %s: please clean it first or select it too", above, l)
+				}
+			}
 		}
 
 		prv, err := getProvider(ctx, c)
 		if err != nil {
 			return fmt.Errorf("error getting provider: %w", err)
 		}
-		target := cli.InfraCleanDone
-		if c.Status > cli.ApplicationCleanDone {
-			log.Info().Msgf("[%s->%s] removing application layer", c.Status, target)
-			c.SaveStatus(cli.ApplicationCleanRunning)
-
-			if err := prv.Destroy(ctx, cli.ApplicationSupport); err != nil {
-				return err
-			}
-
-			c.SaveStatus(cli.ApplicationCleanDone)
-			log.Info().Msgf("[%s->%s] application layer removed", c.Status, target)
+		if err := syncRemoteState(c, prv); err != nil {
+			return err
 		}
+		if err := lockProject(c, "clean", true); err != nil {
+			return err
+		}
+		defer unlockProject(c)
+		if err := setUpTerraform(c); err != nil {
+			return err
+		}
+		target := layers[0].Cleaned()
+		for i := len(layers) - 1; i >= 0; i-- {
+			l := layers[i]
+			if !c.Layer(l).State.Deployed() {
+				continue
+			}
+			log.Info().Msgf("[%s->%s] removing %s layer", c.Status, target, l)
+			c.SaveLayerState(l, cli.LayerDestroying)
 
-		if c.Status > cli.PlatformCleanDone {
-			log.Info().Msgf("[%s->%s] removing platform layer", c.Status, target)
-			c.SaveStatus(cli.PlatformCleanRunning)
-
-			if err := prv.Destroy(ctx, cli.Platform); err != nil {
+			if err := prv.Destroy(ctx, l); err != nil {
+				c.SaveLayerError(l, err)
 				return err
 			}
 
-			c.SaveStatus(cli.PlatformCleanDone)
-			log.Info().Msgf("[%s->%s] platform layer removed", c.Status, target)
+			c.SaveLayerState(l, cli.LayerDestroyed)
+			log.Info().Msgf("[%s->%s] %s layer removed", c.Status, target, l)
 		}
 
-		if c.Status > cli.InfraCleanDone {
-			log.Info().Msgf("[%s->%s] removing infra layer", c.Status, target)
-			c.SaveStatus(cli.InfraCleanRunning)
-
-			if err := prv.Destroy(ctx, cli.Infrastructure); err != nil {
-				return err
-			}
-
-			c.SaveStatus(cli.InfraCleanDone)
-			log.Info().Msgf("[%s->%s] infra layer removed", c.Status, target)
+		if selected {
+			// the project is kept, so that up can deploy again the layers removed
+			log.Info().Msgf("[%s] selected layers removed", c.Status)
+			return nil
 		}
 
+		// the state store is going away together with the remote copy of the state
+		c.SetRemoteState(ctx, nil)
 		err = prv.CleanProvider(ctx)
 		if err != nil {
 			log.Error().Msgf("error during clean of cloud resources: %s", err)
@@ -88,9 +103,7 @@ var cleanCmd = &cobra.Command{
 		}
 		log.Info().Msgf("removing %s/%s", c.Workdir, c.Name)
 
-		os.RemoveAll(c.WorkdirProject)
-		os.RemoveAll(c.Workdir + "/caravan.state")
-		return nil
+		return c.Delete()
 	},
 }
 
@@ -98,4 +111,6 @@ func init() {
 	rootCmd.AddCommand(cleanCmd)
 
 	cleanCmd.PersistentFlags().BoolVarP(&force, FlagForce, FlagForceShort, false, "force cleanup of S3 bucket")
+	addLayerFlags(cleanCmd, "destroy")
+	addResumeFlags(cleanCmd)
 }
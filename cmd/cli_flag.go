@@ -20,6 +20,28 @@ const (
 	FlagLinuxDistroShort CliFlag = "l"
 	FlagEdition          CliFlag = "edition"
 	FlagEditionShort     CliFlag = "e"
+	FlagSavedPlan        CliFlag = "saved-plan"
+	FlagRemoteState      CliFlag = "remote-state"
+	FlagStateKeyFile     CliFlag = "state-key-file"
+	FlagNewStateKeyFile  CliFlag = "new-key-file"
+	FlagWait             CliFlag = "wait"
+	FlagOutput           CliFlag = "output"
+	FlagOutputShort      CliFlag = "o"
+	FlagTerraformVersion CliFlag = "terraform-version"
+	FlagTerraformCache   CliFlag = "terraform-cache"
+	FlagOffline          CliFlag = "offline"
+	FlagLayer            CliFlag = "layer"
+	FlagFrom             CliFlag = "from"
+	FlagTo               CliFlag = "to"
+	FlagResume           CliFlag = "resume"
+	FlagResetTo          CliFlag = "reset-to"
+	FlagDirect           CliFlag = "direct"
+	FlagVaultStandbyOK   CliFlag = "vault-standby-ok"
+	FlagWatch            CliFlag = "watch"
+	FlagInterval         CliFlag = "interval"
+	FlagCheckTimeout     CliFlag = "check-timeout"
+	FlagServe            CliFlag = "serve"
+	FlagConsulTokenRole  CliFlag = "consul-token-role"
 
 	FlagGCPParentProject CliFlag = "gcp-parent-project"
 	FlagGCPDnsZone       CliFlag = "gcp-dns-zone"
@@ -0,0 +1,550 @@
+package cmd
+
+import (
+	"bytes"
+	"caravan-cli/cli"
+	"caravan-cli/cli/checker"
+	"caravan-cli/provider"
+	"caravan-cli/terraform"
+	"caravan-cli/terraform/terraformtest"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// fakeProvider runs the generic layered flow on a fake terraform, without any cloud resource.
+type fakeProvider struct {
+	provider.GenericProvider
+	cleaned  bool
+	locks    []provider.StateLock
+	released []provider.StateLock
+}
+
+func (p *fakeProvider) GetTemplates(ctx context.Context) ([]cli.Template, error) { return nil, nil }
+func (p *fakeProvider) ValidateConfiguration(ctx context.Context) error          { return nil }
+func (p *fakeProvider) InitProvider(ctx context.Context) error                   { return nil }
+func (p *fakeProvider) PullState(ctx context.Context) ([]byte, string, error) {
+	return nil, "", cli.RemoteStateNotFound{}
+}
+func (p *fakeProvider) PushState(ctx context.Context, data []byte, version string) (string, error) {
+	return "", nil
+}
+
+func (p *fakeProvider) StateLocks(ctx context.Context) ([]provider.StateLock, error) {
+	return p.locks, nil
+}
+
+func (p *fakeProvider) ReleaseStateLock(ctx context.Context, lock provider.StateLock) error {
+	p.released = append(p.released, lock)
+	return nil
+}
+
+func (p *fakeProvider) CleanProvider(ctx context.Context) error {
+	p.cleaned = true
+	return nil
+}
+
+type fakeChecker struct{}
+
+func (fakeChecker) Status(ctx context.Context) bool                { return true }
+func (fakeChecker) Version(ctx context.Context) string             { return "fake" }
+func (fakeChecker) CheckURL(ctx context.Context, path string) bool { return true }
+
+// setUpProject creates a project with the given status in a temporary directory and replaces
+// the provider and the checkers with fakes.
+func setUpProject(t *testing.T, status cli.Status) (*cli.Config, *fakeProvider, *terraformtest.Fake) {
+	t.Helper()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	c, err := cli.NewConfigFromScratch("name", provider.AWS, "eu-south-1")
+	if err != nil {
+		t.Fatalf("unable to create config: %s", err)
+	}
+	if err := c.SetDomain("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	c.VaultRootToken = "vault-token"
+	c.NomadToken = "nomad-token"
+	c.DeployNomad = true
+	c.SetStatus(status)
+	c.Save()
+
+	f := &terraformtest.Fake{}
+	p := &fakeProvider{}
+	oldProvider, oldChecker, oldURLChecker := getProvider, newChecker, newURLChecker
+	getProvider = func(ctx context.Context, c *cli.Config) (provider.Provider, error) {
+		p.GenericProvider = provider.GenericProvider{Caravan: c, Executor: f}
+		return p, nil
+	}
+	newChecker = func(c *cli.Config, tool string) (checker.Checker, error) { return fakeChecker{}, nil }
+	newURLChecker = func(c *cli.Config, tool string) (urlChecker, error) { return fakeChecker{}, nil }
+	t.Cleanup(func() { getProvider, newChecker, newURLChecker = oldProvider, oldChecker, oldURLChecker })
+
+	return c, p, f
+}
+
+func execute(args ...string) error {
+	// flag values are kept by cobra between executions
+	for _, c := range rootCmd.Commands() {
+		c.Flags().VisitAll(func(f *pflag.Flag) {
+			if !f.Changed {
+				return
+			}
+			if s, ok := f.Value.(pflag.SliceValue); ok {
+				_ = s.Replace([]string{})
+			} else {
+				_ = f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+	}
+	rootCmd.SetArgs(append(args, "--log-level", "error"))
+	return rootCmd.Execute()
+}
+
+func TestUp(t *testing.T) {
+	c, _, f := setUpProject(t, cli.InitDone)
+	if err := os.MkdirAll(c.WorkdirInfra, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	f.Outputs = map[string]map[string]terraform.OutputValue{
+		c.WorkdirInfra: {
+			cli.OutputVaultRootToken:  {Sensitive: true, Value: json.RawMessage(`"root-token"`)},
+			cli.OutputConsulEndpoint:  {Value: json.RawMessage(`"https://consul.example.com"`)},
+			cli.OutputCACerts:         {Value: json.RawMessage(`"-----BEGIN CERTIFICATE-----"`)},
+			cli.OutputLoadBalancerDNS: {Value: json.RawMessage(`"lb.example.com"`)},
+		},
+	}
+
+	if err := execute("up"); err != nil {
+		t.Fatalf("error running up: %s", err)
+	}
+
+	env := map[string]string{"VAULT_TOKEN": "root-token", "NOMAD_TOKEN": "nomad-token"}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirInfra, VarFile: "name-infra.tfvars", Target: "*", Env: map[string]string{}},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra},
+		terraformtest.Call{Command: "output", Workdir: c.WorkdirInfra, Env: map[string]string{}},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Target: "*", Env: env},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*", Env: env},
+	)
+
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.ApplicationDeployDone {
+		t.Errorf("got status %s but wanted %s", got.Status, cli.ApplicationDeployDone)
+	}
+	for _, l := range cli.Layers {
+		if ls := got.Layer(l); ls.State != cli.LayerReady || ls.LastApply == nil {
+			t.Errorf("layer %s not recorded as applied: %+v", l, ls)
+		}
+	}
+	if got.Endpoint(cli.Consul) != "https://consul.example.com" || got.Endpoint(cli.Vault) != "https://vault.name.example.com" || got.LoadBalancerDNS != "lb.example.com" {
+		t.Errorf("infra outputs not read: %s, %s, %s", got.Endpoint(cli.Consul), got.Endpoint(cli.Vault), got.LoadBalancerDNS)
+	}
+	if ca, err := os.ReadFile(got.CAPath); err != nil || string(ca) != "-----BEGIN CERTIFICATE-----" {
+		t.Errorf("CA bundle not written to %s: %v", got.CAPath, err)
+	}
+}
+
+func TestUpResume(t *testing.T) {
+	c, _, f := setUpProject(t, cli.PlatformDeployDone)
+	f.Errors = map[string]error{"apply": errors.New("boom")}
+
+	if err := execute("up"); err == nil {
+		t.Fatalf("apply error not reported")
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*"},
+	)
+
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.ApplicationDeployRunning {
+		t.Errorf("got status %s but wanted %s", got.Status, cli.ApplicationDeployRunning)
+	}
+}
+
+func TestUpLayer(t *testing.T) {
+	c, _, f := setUpProject(t, cli.ApplicationDeployDone)
+
+	if err := execute("up", "--layer", "platform"); err != nil {
+		t.Fatalf("error running up: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Target: "*"},
+	)
+
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.ApplicationDeployDone {
+		t.Errorf("got status %s but wanted %s", got.Status, cli.ApplicationDeployDone)
+	}
+}
+
+func TestUpLayerFailure(t *testing.T) {
+	_, _, f := setUpProject(t, cli.ApplicationDeployDone)
+	f.Errors = map[string]error{"apply": errors.New("boom")}
+
+	if err := execute("up", "--from", "platform", "--to", "platform"); err == nil {
+		t.Fatalf("apply error not reported")
+	}
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.PlatformDeployRunning {
+		t.Errorf("got status %s but wanted %s", got.Status, cli.PlatformDeployRunning)
+	}
+}
+
+func TestUpLayerRequired(t *testing.T) {
+	_, _, f := setUpProject(t, cli.InitDone)
+
+	if err := execute("up", "--layer", "application"); err == nil {
+		t.Errorf("missing platform layer not reported")
+	}
+	f.AssertCalls(t)
+}
+
+func TestClean(t *testing.T) {
+	c, p, f := setUpProject(t, cli.ApplicationDeployDone)
+
+	if err := execute("clean"); err != nil {
+		t.Fatalf("error running clean: %s", err)
+	}
+
+	env := map[string]string{"VAULT_TOKEN": "vault-token", "NOMAD_TOKEN": "nomad-token"}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "destroy", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Env: env},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "destroy", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Env: env},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra},
+		terraformtest.Call{Command: "destroy", Workdir: c.WorkdirInfra, VarFile: "name-infra.tfvars", Env: map[string]string{}},
+	)
+	if !p.cleaned {
+		t.Errorf("provider resources not cleaned")
+	}
+	if _, err := os.Stat(c.WorkdirProject); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("project directory %s not removed", c.WorkdirProject)
+	}
+}
+
+func TestCleanLayer(t *testing.T) {
+	c, p, f := setUpProject(t, cli.ApplicationDeployDone)
+
+	if err := execute("clean", "--layer", "platform"); err == nil {
+		t.Errorf("application layer deployed on top of platform not reported")
+	}
+	if err := execute("clean", "--from", "application", "--to", "platform"); err != nil {
+		t.Fatalf("error running clean: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "destroy", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars"},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "destroy", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars"},
+	)
+	if p.cleaned {
+		t.Errorf("provider resources cleaned")
+	}
+
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.PlatformCleanDone {
+		t.Errorf("got status %s but wanted %s", got.Status, cli.PlatformCleanDone)
+	}
+}
+
+func TestSelectLayers(t *testing.T) {
+	all := []cli.DeployLayer{cli.Infrastructure, cli.Platform, cli.ApplicationSupport}
+	tests := []struct {
+		names    []string
+		from, to string
+		reverse  bool
+		want     []cli.DeployLayer
+		selected bool
+		err      bool
+	}{
+		{want: all},
+		{names: []string{"application", "infra"}, want: []cli.DeployLayer{cli.Infrastructure, cli.ApplicationSupport}, selected: true},
+		{from: "platform", want: all[1:], selected: true},
+		{to: "platform", want: all[:2], selected: true},
+		{from: "application", to: "platform", reverse: true, want: all[1:], selected: true},
+		{names: []string{"infra"}, from: "platform", err: true},
+		{from: "application", to: "infra", err: true},
+		{names: []string{"network"}, err: true},
+	}
+	for _, tt := range tests {
+		got, selected, err := selectLayers(tt.names, tt.from, tt.to, tt.reverse)
+		if (err != nil) != tt.err {
+			t.Errorf("%v %s-%s: got error %v", tt.names, tt.from, tt.to, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) || selected != tt.selected {
+			t.Errorf("%v %s-%s: got %v (%t) but wanted %v (%t)", tt.names, tt.from, tt.to, got, selected, tt.want, tt.selected)
+		}
+	}
+}
+
+func TestUpInterrupted(t *testing.T) {
+	c, _, f := setUpProject(t, cli.ApplicationDeployRunning)
+
+	if err := execute("up"); err == nil {
+		t.Fatalf("interrupted run not reported")
+	}
+	f.AssertCalls(t)
+
+	if err := execute("up", "--resume"); err != nil {
+		t.Fatalf("error resuming up: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*"},
+	)
+	if _, err := os.Stat(c.LockPath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lock file %s not removed", c.LockPath())
+	}
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.ApplicationDeployDone || got.Lease != nil {
+		t.Errorf("got status %s and lease %v but wanted %s and no lease", got.Status, got.Lease, cli.ApplicationDeployDone)
+	}
+}
+
+func TestUpResetTo(t *testing.T) {
+	c, _, f := setUpProject(t, cli.PlatformDeployRunning)
+
+	if err := execute("up", "--reset-to", "PlatformConsulDeployDone"); err != nil {
+		t.Fatalf("error running up: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*"},
+	)
+}
+
+func TestUpLocked(t *testing.T) {
+	c, _, f := setUpProject(t, cli.PlatformConsulDeployDone)
+	lease, _ := json.Marshal(cli.Lease{PID: os.Getpid(), Host: hostname(t), Command: "up"})
+	if err := os.WriteFile(c.LockPath(), lease, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := execute("up")
+	if !errors.As(err, &cli.ProjectLocked{}) {
+		t.Fatalf("got error %v but wanted the project to be locked", err)
+	}
+	f.AssertCalls(t)
+	if _, err := os.Stat(c.LockPath()); err != nil {
+		t.Errorf("lock file of the other process removed: %s", err)
+	}
+}
+
+func TestInitLocked(t *testing.T) {
+	c, _, _ := setUpProject(t, cli.InitDone)
+	lease, _ := json.Marshal(cli.Lease{PID: os.Getpid(), Host: hostname(t), Command: "up"})
+	if err := os.WriteFile(c.LockPath(), lease, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := execute("init", "--project", "name", "--provider", provider.AWS, "--domain", "example.com")
+	if !errors.As(err, &cli.ProjectLocked{}) {
+		t.Fatalf("got error %v but wanted the project to be locked", err)
+	}
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if got.Status != cli.InitDone {
+		t.Errorf("status of the locked project changed to %s", got.Status)
+	}
+}
+
+func TestInitProjectRequired(t *testing.T) {
+	setUpProject(t, cli.InitDone)
+
+	err := execute("init", "--provider", provider.AWS, "--domain", "example.com")
+	if err == nil || !strings.Contains(err.Error(), `"project"`) {
+		t.Errorf("got error %v but wanted the project flag to be required", err)
+	}
+	// the global flag is the only one
+	if f := initCmd.Flags().Lookup(FlagProject); f == nil || f != rootCmd.PersistentFlags().Lookup(FlagProject) {
+		t.Errorf("init does not use the global --%s flag", FlagProject)
+	}
+}
+
+func hostname(t *testing.T) string {
+	t.Helper()
+	h, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestUpStopped(t *testing.T) {
+	c, _, f := setUpProject(t, cli.PlatformConsulDeployDone)
+	f.Errors = map[string]error{"apply": fmt.Errorf("terraform interrupted: %w", context.Canceled)}
+
+	if err := execute("up"); err == nil {
+		t.Fatalf("interruption not reported")
+	}
+	got, err := cli.NewConfigFromFile("name")
+	if err != nil {
+		t.Fatalf("unable to read config: %s", err)
+	}
+	if ls := got.Layer(cli.ApplicationSupport); ls.State != cli.LayerApplying || !ls.Interrupted {
+		t.Errorf("application layer not saved as interrupted: %+v", ls)
+	}
+	if got.Status != cli.ApplicationCleanDone {
+		t.Errorf("got status %s but wanted %s once the run stopped", got.Status, cli.ApplicationCleanDone)
+	}
+
+	// a run stopped gracefully is resumed without --resume
+	f.Errors = nil
+	if err := execute("up"); err != nil {
+		t.Fatalf("error resuming up: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*"},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*"},
+	)
+}
+
+func TestUnlock(t *testing.T) {
+	c, p, f := setUpProject(t, cli.PlatformDeployRunning)
+	p.locks = []provider.StateLock{
+		{Layer: cli.Infrastructure, LockInfo: terraform.LockInfo{ID: "infra-lock"}},
+		{Layer: cli.Platform, LockInfo: terraform.LockInfo{ID: "platform-lock"}},
+	}
+
+	if err := execute("unlock"); err != nil {
+		t.Fatalf("error listing locks: %s", err)
+	}
+	f.AssertCalls(t)
+
+	if err := execute("unlock", "--layer", "platform", "--force"); err != nil {
+		t.Fatalf("error releasing locks: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "force-unlock", Workdir: c.WorkdirPlatform, LockID: "platform-lock"},
+	)
+
+	if err := execute("unlock", "--force", "--direct"); err != nil {
+		t.Fatalf("error removing locks: %s", err)
+	}
+	if len(p.released) != 2 || p.released[0].ID != "infra-lock" || p.released[1].ID != "platform-lock" {
+		t.Errorf("got released locks %v but wanted both", p.released)
+	}
+}
+
+func TestStatusWatch(t *testing.T) {
+	c, _, _ := setUpProject(t, cli.ApplicationDeployDone)
+
+	// watch polls the given vault states, the last poll being interrupted before being reported
+	watch := func(tty bool, states ...checker.HealthState) string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		polls := 0
+		poll := func(ctx context.Context, c *cli.Config) map[string]cli.Tool {
+			state := states[polls]
+			if polls++; polls == len(states) {
+				cancel()
+			}
+			return map[string]cli.Tool{cli.Vault: {Status: state == checker.Healthy, Health: checker.HealthResult{State: state}}}
+		}
+		var out bytes.Buffer
+		if err := watchStatus(ctx, &out, c, poll, time.Millisecond, tty); err != nil {
+			t.Fatalf("error watching status: %s", err)
+		}
+		return out.String()
+	}
+
+	out := watch(false, checker.Sealed, checker.Sealed, checker.Healthy)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"tool":"vault","to":"sealed"`) {
+		t.Errorf("unexpected changes:\n%s", out)
+	}
+
+	out = watch(true, checker.Sealed, checker.Healthy, checker.Healthy)
+	if !strings.Contains(out, "vault   sealed -> healthy") {
+		t.Errorf("transition not shown:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "stopped watching\n") {
+		t.Errorf("stop not shown:\n%s", out)
+	}
+}
+
+func TestStatusServe(t *testing.T) {
+	c, _, _ := setUpProject(t, cli.ApplicationDeployDone)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the second poll tells that the results of the first one are served
+	polls, polled := 0, make(chan struct{})
+	poll := func(ctx context.Context, c *cli.Config) map[string]cli.Tool {
+		if polls++; polls == 2 {
+			close(polled)
+		}
+		return map[string]cli.Tool{cli.Vault: {Status: true, Health: checker.HealthResult{State: checker.Healthy}}}
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- serveMetricsOn(ctx, l, c, poll, time.Millisecond)
+	}()
+	<-polled
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("unable to get metrics: %s", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := `caravan_tool_up{project="` + c.Name + `",tool="vault"} 1`; !strings.Contains(string(b), want) {
+		t.Errorf("missing %s in:\n%s", want, b)
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("error stopping the exporter: %s", err)
+	}
+}
@@ -6,10 +6,20 @@ import (
 	"caravan-cli/provider/aws"
 	"caravan-cli/provider/azure"
 	"caravan-cli/provider/gcp"
+	"caravan-cli/terraform"
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
 )
 
+// EnvTerraformCache is the environment variable holding the default terraform cache directory.
+const EnvTerraformCache = "CARAVAN_TERRAFORM_CACHE"
+
 var (
 	// Common.
 	prv         = ""
@@ -21,6 +31,31 @@ var (
 	deployNomad = true
 	distro      = ""
 	edition     = ""
+	savedPlan   = false
+	remoteState = false
+	waitReady   = false
+
+	// Health checks.
+	vaultStandbyOK   = false
+	watch            = false
+	watchInterval    = 5 * time.Second
+	serveAddr        = ""
+	toolCheckTimeout = cli.DefaultCheckTimeout
+	consulTokenRole  = ""
+
+	// Layers.
+	layerNames = []string{}
+	fromLayer  = ""
+	toLayer    = ""
+
+	// Interrupted runs.
+	resume  = false
+	resetTo = ""
+
+	// Terraform.
+	terraformVersion = cli.DefaultTerraformVersion
+	terraformCache   = ""
+	offline          = false
 
 	// GCP.
 	gcpParentProject = ""
@@ -35,7 +70,8 @@ var (
 	azUseCLI         = false
 )
 
-func getProvider(ctx context.Context, c *cli.Config) (provider.Provider, error) {
+// getProvider builds the provider of the project.
+var getProvider = func(ctx context.Context, c *cli.Config) (provider.Provider, error) {
 	var p provider.Provider
 	var err error
 	switch c.Provider {
@@ -53,3 +89,150 @@ func getProvider(ctx context.Context, c *cli.Config) (provider.Provider, error)
 	}
 	return p, nil
 }
+
+// selectLayers returns the layers picked with the --layer, --from and --to flags, in the order up
+// applies them. When none of the flags is set all the layers are returned and selected is false.
+// With reverse the --from and --to layers are taken in the order clean destroys them.
+func selectLayers(names []string, from, to string, reverse bool) (layers []cli.DeployLayer, selected bool, err error) {
+	if len(names) == 0 && from == "" && to == "" {
+		return cli.Layers, false, nil
+	}
+	if reverse {
+		from, to = to, from
+	}
+	first, last := cli.Infrastructure, cli.ApplicationSupport
+	if from != "" {
+		if first, err = cli.ParseLayer(from); err != nil {
+			return nil, false, err
+		}
+	}
+	if to != "" {
+		if last, err = cli.ParseLayer(to); err != nil {
+			return nil, false, err
+		}
+	}
+	if first > last {
+		if reverse {
+			first, last = last, first
+		}
+		return nil, false, fmt.Errorf("--%s %s comes after --%s %s", FlagFrom, first, FlagTo, last)
+	}
+	picked := map[cli.DeployLayer]bool{}
+	for _, n := range names {
+		l, err := cli.ParseLayer(n)
+		if err != nil {
+			return nil, false, err
+		}
+		picked[l] = true
+	}
+	for _, l := range cli.Layers {
+		if l < first || l > last || (len(picked) > 0 && !picked[l]) {
+			continue
+		}
+		layers = append(layers, l)
+	}
+	if len(layers) == 0 {
+		return nil, false, fmt.Errorf("no layer selected between %s and %s", first, last)
+	}
+	return layers, true, nil
+}
+
+// requireProject checks that the global --project flag is given, for the commands creating the project
+// rather than acting on the current one.
+func requireProject() error {
+	if name == "" {
+		return fmt.Errorf("required flag(s) \"%s\" not set", FlagProject)
+	}
+	return nil
+}
+
+// addLayerFlags adds to the command the flags selecting the layers it acts on.
+func addLayerFlags(cmd *cobra.Command, action string) {
+	cmd.Flags().StringSliceVar(&layerNames, FlagLayer, []string{}, "layer to "+action+": infra, platform or application (can be repeated, default all)")
+	cmd.Flags().StringVar(&fromLayer, FlagFrom, "", "first layer to "+action+" (infra, platform or application)")
+	cmd.Flags().StringVar(&toLayer, FlagTo, "", "last layer to "+action+" (infra, platform or application)")
+}
+
+// addResumeFlags adds to the command the flags choosing how to go on after an interrupted run.
+func addResumeFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&resume, FlagResume, false, "go on from the layers left running by an interrupted run")
+	cmd.Flags().StringVar(&resetTo, FlagResetTo, "", "set the project status before running (e.g. InfraCheckDone)")
+}
+
+// lockProject acquires the lease of the project for the command. When checkInterrupted is set it also
+// refuses to go on from the layers left running by an interrupted run, unless it is resumed or the status reset.
+func lockProject(c *cli.Config, command string, checkInterrupted bool) (err error) {
+	stale, err := c.Lock(command)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = c.Unlock()
+		}
+	}()
+	if stale != nil {
+		log.Warn().Msgf("[%s] %s did not complete: taking over its lease", c.Status, stale)
+	}
+	if !checkInterrupted {
+		return nil
+	}
+	if resetTo != "" {
+		s, err := cli.ParseStatus(resetTo)
+		if err != nil {
+			return err
+		}
+		log.Warn().Msgf("[%s] resetting status of project %s to %s", c.Status, c.Name, s)
+		c.SaveStatus(s)
+		return nil
+	}
+	if layers := c.Stalled(); len(layers) > 0 {
+		if !resume {
+			return fmt.Errorf("[%s] a previous run on project %s was interrupted while operating on layer %s: please run with --%s to go on or --%s <status> to set the status first",
+				c.Status, c.Name, layers[0], FlagResume, FlagResetTo)
+		}
+		log.Warn().Msgf("[%s] resuming the interrupted run on layer %s", c.Status, layers[0])
+	}
+	return nil
+}
+
+// unlockProject releases the lease of the project.
+func unlockProject(c *cli.Config) {
+	if err := c.Unlock(); err != nil {
+		log.Error().Msgf("unable to unlock project %s: %s", c.Name, err)
+	}
+}
+
+// syncRemoteState attaches the provider's state store to the config and, when the remote state
+// is enabled, brings the local and the remote state files in line.
+func syncRemoteState(c *cli.Config, p provider.Provider) error {
+	// the state is still synced while stopping on a signal, to record the interrupted layers
+	c.SetRemoteState(context.Background(), p)
+	if err := c.Sync(); err != nil {
+		return fmt.Errorf("error syncing remote state: %w", err)
+	}
+	return nil
+}
+
+// setUpTerraform installs the terraform version pinned by the project in the bin directory of the
+// workdir and makes the provider run it. Projects without a pinned version use the terraform in $PATH.
+func setUpTerraform(c *cli.Config) error {
+	if c.TerraformVersion == "" {
+		log.Debug().Msgf("no terraform version pinned: using terraform from $PATH")
+		return nil
+	}
+	cache := terraformCache
+	if cache == "" {
+		cache = os.Getenv(EnvTerraformCache)
+	}
+	i := terraform.NewInstaller(filepath.Join(c.Workdir, "bin"), cache, offline)
+	path, err := i.Install(ctx, c.TerraformVersion)
+	if err != nil {
+		return fmt.Errorf("error installing terraform %s: %w", c.TerraformVersion, err)
+	}
+	if c.TerraformBinary, err = filepath.Abs(path); err != nil {
+		return err
+	}
+	log.Debug().Msgf("using terraform %s from %s", c.TerraformVersion, c.TerraformBinary)
+	return nil
+}
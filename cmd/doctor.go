@@ -0,0 +1,101 @@
+// Doctor command.
+//
+// Copyright © 2021 Bitrock s.r.l. <devops@bitrock.it>
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/doctor"
+	"caravan-cli/provider"
+	"caravan-cli/terraform"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var output = "text"
+
+// doctorCmd represents the doctor command.
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the environment caravan depends on",
+	Long: `Runs the preflight checks of the terraform binary, the access to the caravan git repos,
+the cloud provider credentials, the resolution of the domain and the write access to the .caravan directory.
+The provider and the domain of the current project are checked when not given: with no provider all of
+them are checked, missing credentials being reported as warnings.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unsupported output format %s: must be text or json", output)
+		}
+
+		repos := []string{"caravan-baking", "caravan-platform", "caravan-application-support"}
+		tf := ""
+		c, err := cli.NewConfigFromFile(name)
+		if err == nil {
+			if c.TerraformVersion != "" {
+				tf = terraform.NewInstaller(filepath.Join(c.Workdir, "bin"), "", true).Path(c.TerraformVersion)
+			}
+			if prv == "" {
+				prv = c.Provider
+			}
+			if domain == "" {
+				domain = c.Domain
+			}
+			azUseCLI = azUseCLI || c.AzureUseCLI
+		} else if !errors.As(err, &cli.ConfigFileNotFound{}) {
+			log.Warn().Msgf("unable to read the project state: %s", err)
+		}
+
+		providers := []string{provider.AWS, provider.GCP, provider.Azure}
+		if prv != "" {
+			providers = []string{prv}
+		}
+		checks := []doctor.Check{doctor.Terraform(tf)}
+		for _, p := range providers {
+			repos = append(repos, "caravan-infra-"+p)
+		}
+		checks = append(checks, doctor.GitRepos("bitrockteam", repos))
+		for _, p := range providers {
+			switch p {
+			case provider.AWS:
+				checks = append(checks, doctor.AWSCredentials(prv != ""))
+			case provider.GCP:
+				checks = append(checks, doctor.GCPCredentials(prv != ""))
+			case provider.Azure:
+				checks = append(checks, doctor.AzureCredentials(azUseCLI, prv != ""))
+			default:
+				return fmt.Errorf("unknown provider %s", p)
+			}
+		}
+		checks = append(checks, doctor.DNS(domain), doctor.Workdir(cli.Workdir))
+
+		r := doctor.Run(ctx, checks, 30*time.Second)
+		if output == "json" {
+			err = r.PrintJSON(os.Stdout)
+		} else {
+			err = r.PrintTable(os.Stdout)
+		}
+		if err != nil {
+			return err
+		}
+		if r.Failed() {
+			return fmt.Errorf("some preflight checks failed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVarP(&prv, FlagProvider, FlagProviderShort, "", "cloud provider to check the credentials of (default is the project provider, or all of them)")
+	doctorCmd.Flags().StringVarP(&domain, FlagDomain, FlagDomainShort, "", "domain to resolve (default is the project domain)")
+	doctorCmd.Flags().BoolVar(&azUseCLI, FlagAZLoginViaCLI, false, "(Azure only) login via CLI")
+	doctorCmd.Flags().StringVarP(&output, FlagOutput, FlagOutputShort, "text", "output format: text or json")
+}
@@ -30,19 +30,19 @@ func init() {
 	rootCmd.AddCommand(initCmd)
 
 	// Common
-	initCmd.Flags().StringVarP(&name, FlagProject, FlagProjectShort, "", "name of project")
 	initCmd.Flags().StringVarP(&prv, FlagProvider, FlagProviderShort, "", "cloud provider")
 	initCmd.Flags().StringVarP(&domain, FlagDomain, FlagDomainShort, "", "")
 	initCmd.Flags().StringVarP(&distro, FlagLinuxDistro, FlagLinuxDistroShort, "ubuntu-2204", "linux distribution for image")
 	initCmd.Flags().StringVarP(&edition, FlagEdition, FlagEditionShort, "os", "Hashicorp tools edition (os: open source/ent: enterprise")
 
-	_ = initCmd.MarkFlagRequired(FlagProject)
 	_ = initCmd.MarkFlagRequired(FlagProvider)
 	_ = initCmd.MarkFlagRequired(FlagDomain)
 
 	initCmd.Flags().StringVarP(&region, FlagRegion, FlagRegionShort, "", "region for the deployment")
 	initCmd.Flags().StringVarP(&branch, FlagBranch, FlagBranchShort, "", "")
 	initCmd.Flags().BoolVar(&deployNomad, FlagDeployNomad, true, "deploy Nomad")
+	initCmd.Flags().BoolVar(&remoteState, FlagRemoteState, false, "keep a copy of the caravan state in the provider's state store")
+	initCmd.Flags().StringVar(&terraformVersion, FlagTerraformVersion, cli.DefaultTerraformVersion, "terraform version to pin, installed in .caravan/bin (empty to use the terraform in $PATH)")
 
 	// GCP
 	initCmd.Flags().StringVar(&gcpParentProject, FlagGCPParentProject, "", "(GCP only) parent-project")
@@ -58,6 +58,9 @@ func init() {
 }
 
 func preRunInit(cmd *cobra.Command, args []string) error {
+	if err := requireProject(); err != nil {
+		return err
+	}
 	switch prv {
 	case "":
 		return nil
@@ -70,7 +73,7 @@ func preRunInit(cmd *cobra.Command, args []string) error {
 }
 
 func executeInit(cmd *cobra.Command, args []string) error {
-	c, err := cli.NewConfigFromFile()
+	c, err := cli.NewConfigFromFile(name)
 	if err != nil {
 		if errors.As(err, &cli.ConfigFileNotFound{}) {
 			c, err = cli.NewConfigFromScratch(name, prv, region)
@@ -78,16 +81,21 @@ func executeInit(cmd *cobra.Command, args []string) error {
 				log.Error().Msgf("unable to create config from scratch: %s", err)
 				return err
 			}
+			c.TerraformVersion = terraformVersion
 		} else {
 			log.Error().Msgf("unable to create config from file: %s", err)
 			return err
 		}
 	}
 	c.LogLevel = logLevel
+	if err := lockProject(c, "init", false); err != nil {
+		return err
+	}
+	defer unlockProject(c)
 	target := cli.InitDone
 	log.Info().Msgf("[%s->%s] running init on project %s", c.Status, target, c.Name)
-	if c.Name != name || c.Provider != prv {
-		return fmt.Errorf("please run a clean before changing project name or provider")
+	if c.Provider != prv {
+		return fmt.Errorf("please run a clean before changing the provider of project %s", c.Name)
 	}
 
 	if err := c.SetDistro(distro); err != nil {
@@ -99,7 +107,16 @@ func executeInit(cmd *cobra.Command, args []string) error {
 
 	log.Debug().Msgf("input: %t - deploy nomad: %t", deployNomad, c.DeployNomad)
 	c.DeployNomad = deployNomad
+	if cmd.Flags().Changed(FlagRemoteState) {
+		c.RemoteState = remoteState
+	}
+	if cmd.Flags().Changed(FlagTerraformVersion) {
+		c.TerraformVersion = terraformVersion
+	}
 	c.Save()
+	if err := cli.UseProject(c.Workdir, c.Name); err != nil {
+		return err
+	}
 
 	if err := c.SetDomain(domain); err != nil {
 		return fmt.Errorf("error setting domain: %w", err)
@@ -109,10 +126,17 @@ func executeInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := setUpTerraform(c); err != nil {
+		return err
+	}
+
 	p, err := getProvider(ctx, c)
 	if err != nil {
 		return err
 	}
+	if err := p.ValidateConfiguration(ctx); err != nil {
+		return err
+	}
 
 	c.SaveStatus(cli.InitRunning)
 
@@ -126,6 +150,10 @@ func executeInit(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if err := syncRemoteState(c, p); err != nil {
+		return err
+	}
+
 	if c.Status < cli.InitDone {
 		c.SaveStatus(cli.InitDone)
 	}
@@ -0,0 +1,82 @@
+// Plan command.
+//
+// Copyright © 2021 Bitrock s.r.l. <devops@bitrock.it>
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// planCmd represents the plan command.
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Preview the changes that up would apply",
+	Long: `Runs terraform plan for the infrastructure, platform and application support layers and saves one plan file per layer.
+The saved plans can then be applied as they are with "up --saved-plan". The layers above the ones deployed cannot be
+planned yet, as they need the outputs of the layers below: only the layers that can already be planned are, and
+"up --saved-plan" applies the others as "up" does.`,
+	RunE: func(cmd *cobra.Command, args []string) (err error) {
+		c, err := cli.NewConfigFromFile(name)
+		if err != nil {
+			if errors.As(err, &cli.ConfigFileNotFound{}) {
+				log.Info().Msgf("please run init")
+				return nil
+			}
+			return err
+		}
+		c.LogLevel = logLevel
+
+		log.Info().Msgf("[%s] running plan on project %s", c.Status, c.Name)
+		if c.Status < cli.InitDone {
+			return fmt.Errorf("project %s is not initialized: please run init", c.Name)
+		}
+		prv, err := getProvider(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := syncRemoteState(c, prv); err != nil {
+			return err
+		}
+		if err := lockProject(c, "plan", false); err != nil {
+			return err
+		}
+		defer unlockProject(c)
+		if err := setUpTerraform(c); err != nil {
+			return err
+		}
+
+		layers := []struct {
+			layer    cli.DeployLayer
+			required cli.Status
+			enabled  bool
+		}{
+			{layer: cli.Infrastructure, required: cli.InitDone, enabled: true},
+			{layer: cli.Platform, required: cli.InfraCheckDone, enabled: true},
+			{layer: cli.ApplicationSupport, required: cli.PlatformConsulDeployDone, enabled: c.DeployNomad},
+		}
+		for _, l := range layers {
+			if !l.enabled {
+				continue
+			}
+			if c.Status < l.required {
+				log.Info().Msgf("[%s] skipping %s plan: requires %s, up --%s applies it without a saved plan", c.Status, l.layer, l.required, FlagSavedPlan)
+				continue
+			}
+			s, err := prv.Plan(ctx, l.layer)
+			if err != nil {
+				return err
+			}
+			log.Info().Msgf("[%s] %s plan saved to %s: %s", c.Status, l.layer, c.LayerPlan(l.layer), s)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(planCmd)
+}
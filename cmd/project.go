@@ -0,0 +1,86 @@
+// Project command.
+//
+// Copyright © 2021 Bitrock s.r.l. <devops@bitrock.it>
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// projectCmd represents the project command.
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage the caravan projects of the current directory",
+	Long: `Several caravan projects can be initialized side by side, each one with its own state under .caravan/<name>.
+The current project is the one up, plan, status and clean act on when --project is not given.`,
+}
+
+var projectListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available projects",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		projects, err := cli.ListProjects(cli.Workdir)
+		if err != nil {
+			return err
+		}
+		current, err := cli.CurrentProject(cli.Workdir)
+		if err != nil {
+			log.Debug().Msgf("no current project: %s", err)
+		}
+		for _, p := range projects {
+			marker := " "
+			if p == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, p)
+		}
+		return nil
+	},
+}
+
+var projectUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Select the current project",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := cli.UseProject(cli.Workdir, args[0]); err != nil {
+			if errors.As(err, &cli.ConfigFileNotFound{}) {
+				return fmt.Errorf("project %s not found: please run init", args[0])
+			}
+			return err
+		}
+		log.Info().Msgf("current project is now %s", args[0])
+		return nil
+	},
+}
+
+var projectShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the local state of a project (default is the current project)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n := name
+		if len(args) == 1 {
+			n = args[0]
+		}
+		c, err := cli.NewConfigFromFile(n)
+		if err != nil {
+			return err
+		}
+		cli.NewReport(c).PrintReport()
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(projectCmd)
+	projectCmd.AddCommand(projectListCmd)
+	projectCmd.AddCommand(projectUseCmd)
+	projectCmd.AddCommand(projectShowCmd)
+}
@@ -2,6 +2,8 @@
 package cmd
 
 import (
+	"caravan-cli/cli"
+	"caravan-cli/terraform"
 	"context"
 	"fmt"
 	"io"
@@ -17,10 +19,11 @@ import (
 )
 
 var (
-	cfgFile  string
-	logLevel string
-	jsonLogs bool
-	ctx      context.Context
+	cfgFile      string
+	logLevel     string
+	jsonLogs     bool
+	stateKeyFile string
+	ctx          context.Context
 )
 
 // rootCmd represents the base command when called without any subcommands.
@@ -56,6 +59,10 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.caravan.yaml)")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level to be used")
 	rootCmd.PersistentFlags().BoolVar(&jsonLogs, "json-logs", false, "log in JSON format (default to pretty console format)")
+	rootCmd.PersistentFlags().StringVarP(&name, FlagProject, FlagProjectShort, "", "name of the project to act on (default is the current project)")
+	rootCmd.PersistentFlags().StringVar(&terraformCache, FlagTerraformCache, "", "directory caching the terraform releases, used by --offline (default is $"+EnvTerraformCache+")")
+	rootCmd.PersistentFlags().BoolVar(&offline, FlagOffline, false, "install terraform from the cache directory only, without downloading it")
+	rootCmd.PersistentFlags().StringVar(&stateKeyFile, FlagStateKeyFile, "", "key file sealing the state secrets, generated if missing (default is $"+cli.EnvStateKeyFile+", or a passphrase from $"+cli.EnvStatePassphrase+")")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -94,19 +101,28 @@ func setUpLogs(out io.Writer, level zerolog.Level, humanLogs bool) error {
 }
 
 func setUpContext() error {
-	sigChannel := make(chan os.Signal, 1)
+	sigChannel := make(chan os.Signal, 2)
+	kill := make(chan struct{})
 	var cancel context.CancelFunc
-	ctx, cancel = context.WithCancel(context.Background())
+	ctx, cancel = context.WithCancel(terraform.WithKill(context.Background(), kill))
 	signal.Notify(sigChannel, os.Interrupt, syscall.SIGTERM)
-	go handleSignal(sigChannel, cancel)
+	go handleSignal(sigChannel, cancel, kill)
 	return nil
 }
 
-func handleSignal(sigChannel chan os.Signal, cancel context.CancelFunc) {
+// handleSignal stops the running command on the first signal, letting terraform exit gracefully,
+// and kills terraform on the second one.
+func handleSignal(sigChannel chan os.Signal, cancel context.CancelFunc, kill chan struct{}) {
+	n := 0
 	for s := range sigChannel {
-		if s == syscall.SIGTERM {
-			log.Debug().Msgf("Received SIGTERM, shutting down...")
+		n++
+		switch n {
+		case 1:
+			log.Warn().Msgf("received %s: stopping, send it again to kill terraform", s)
 			cancel()
+		case 2:
+			log.Warn().Msgf("received %s again: killing terraform", s)
+			close(kill)
 		}
 	}
 }
@@ -123,5 +139,19 @@ func rootPreRun(cmd *cobra.Command, args []string) error {
 	if err = setUpContext(); err != nil {
 		return err
 	}
+	if err = setUpSealer(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func setUpSealer() error {
+	s, err := cli.SealerFromEnv(stateKeyFile)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		cli.UseSealer(s)
+	}
 	return nil
 }
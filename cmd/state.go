@@ -0,0 +1,155 @@
+// State command.
+//
+// Copyright © 2021 Bitrock s.r.l. <devops@bitrock.it>
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// envNewStatePassphrase is the environment variable holding the new passphrase used by rekey.
+const envNewStatePassphrase = "CARAVAN_STATE_NEW_PASSPHRASE"
+
+var newStateKeyFile = ""
+
+// stateCmd represents the state command.
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Manage the caravan state of a project",
+	Long:  `The caravan state of a project can be kept in the provider's state store (the one holding the terraform states) to share it among the team.`,
+}
+
+var statePullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Replace the local caravan state with the one kept in the provider's state store",
+	Long: `Replaces the local caravan state with the one kept in the provider's state store.
+When the project is not available locally --project and --provider (and the provider specific flags) are needed to locate the state store.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cli.NewConfigFromFile(name)
+		if err != nil {
+			if !errors.As(err, &cli.ConfigFileNotFound{}) || name == "" || prv == "" {
+				return fmt.Errorf("project not available locally: please provide --%s and --%s: %w", FlagProject, FlagProvider, err)
+			}
+			if c, err = cli.NewConfigFromScratch(name, prv, region); err != nil {
+				return err
+			}
+			c.AzureResourceGroup = azResourceGroup
+			c.AzureSubscriptionID = azSubscriptionID
+			c.AzureUseCLI = azUseCLI
+		}
+		c.LogLevel = logLevel
+
+		p, err := getProvider(ctx, c)
+		if err != nil {
+			return err
+		}
+		c.SetRemoteState(ctx, p)
+		if err := c.Pull(); err != nil {
+			return fmt.Errorf("error pulling state of project %s: %w", c.Name, err)
+		}
+		if err := cli.UseProject(c.Workdir, c.Name); err != nil {
+			return err
+		}
+		log.Info().Msgf("[%s] pulled state of project %s (serial %d)", c.Status, c.Name, c.Serial)
+		return nil
+	},
+}
+
+var statePushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Replace the caravan state kept in the provider's state store with the local one",
+	Long:  `Replaces the caravan state kept in the provider's state store with the local one and enables the automatic sync of the state.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cli.NewConfigFromFile(name)
+		if err != nil {
+			return err
+		}
+		c.LogLevel = logLevel
+		if c.Status < cli.InitDone {
+			return fmt.Errorf("project %s is not initialized: please run init", c.Name)
+		}
+
+		p, err := getProvider(ctx, c)
+		if err != nil {
+			return err
+		}
+		c.RemoteState = true
+		c.Save()
+		c.SetRemoteState(ctx, p)
+		if err := c.Push(); err != nil {
+			return fmt.Errorf("error pushing state of project %s: %w", c.Name, err)
+		}
+		log.Info().Msgf("[%s] pushed state of project %s (serial %d)", c.Status, c.Name, c.Serial)
+		return nil
+	},
+}
+
+var stateRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Seal the state secrets with a new key",
+	Long: `Opens the state secrets with the current key (--state-key-file or $` + cli.EnvStatePassphrase + `) and seals them again
+with the key file given by --new-key-file, generated if missing, or with the passphrase in $` + envNewStatePassphrase + `.
+Secrets stored in plain text by previous versions are sealed as well.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cli.NewConfigFromFile(name)
+		if err != nil {
+			return err
+		}
+		c.LogLevel = logLevel
+
+		var s cli.Sealer
+		switch {
+		case newStateKeyFile != "":
+			s, err = cli.NewKeyFileSealer(newStateKeyFile)
+		case os.Getenv(envNewStatePassphrase) != "":
+			s, err = cli.NewPassphraseSealer(os.Getenv(envNewStatePassphrase))
+		default:
+			return fmt.Errorf("please provide the new key with --%s or $%s", FlagNewStateKeyFile, envNewStatePassphrase)
+		}
+		if err != nil {
+			return err
+		}
+
+		if c.RemoteState {
+			p, err := getProvider(ctx, c)
+			if err != nil {
+				return err
+			}
+			// the remote state is brought in line while it is still sealed with the current key
+			if err := syncRemoteState(c, p); err != nil {
+				return err
+			}
+		}
+		if err := lockProject(c, "rekey", false); err != nil {
+			return err
+		}
+		defer unlockProject(c)
+
+		if err := c.Reseal(s); err != nil {
+			return fmt.Errorf("error sealing state of project %s: %w", c.Name, err)
+		}
+		log.Info().Msgf("[%s] state of project %s sealed with the new key", c.Status, c.Name)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(statePullCmd)
+	stateCmd.AddCommand(statePushCmd)
+	stateCmd.AddCommand(stateRekeyCmd)
+
+	stateRekeyCmd.Flags().StringVar(&newStateKeyFile, FlagNewStateKeyFile, "", "key file to seal the state secrets with, generated if missing")
+
+	statePullCmd.Flags().StringVarP(&prv, FlagProvider, FlagProviderShort, "", "cloud provider (only needed when the project is not available locally)")
+	statePullCmd.Flags().StringVarP(&region, FlagRegion, FlagRegionShort, "", "region of the deployment")
+	statePullCmd.Flags().StringVar(&azResourceGroup, FlagAZResourceGroup, "", "(Azure only) resource group name")
+	statePullCmd.Flags().StringVar(&azSubscriptionID, FlagAZSubscriptionID, "", "(Azure only) subscription ID")
+	statePullCmd.Flags().BoolVar(&azUseCLI, FlagAZLoginViaCLI, false, "(Azure only) login via CLI")
+}
@@ -5,8 +5,12 @@ package cmd
 
 import (
 	"caravan-cli/cli"
-	"strings"
+	"errors"
+	"fmt"
+	"os"
+	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -18,29 +22,94 @@ var statusCmd = &cobra.Command{
 	Long: `Gets and diplay the current status for caravan both locally and remotely
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		c, err := cli.NewConfigFromFile()
+		if err := bindTimeoutFlags(cmd); err != nil {
+			return err
+		}
+		if output != "text" && output != "json" && output != "yaml" {
+			return fmt.Errorf("unsupported output format %s: must be text, json or yaml", output)
+		}
+		if watch && serveAddr != "" {
+			return fmt.Errorf("--%s and --%s cannot be used together", FlagWatch, FlagServe)
+		}
+		if output != "text" || watch {
+			// keep stdout for the document only
+			if err := setUpLogs(os.Stderr, zerolog.GlobalLevel(), !jsonLogs); err != nil {
+				return err
+			}
+		}
+		c, err := cli.NewConfigFromFile(name)
 		if err != nil {
-			if strings.Contains(err.Error(), "no such file or directory") {
+			if errors.As(err, &cli.ConfigFileNotFound{}) {
 				log.Info().Msgf("project status is: %s", cli.InitMissing)
-				return nil
+				return printStatus(cli.MissingStatusDocument(), nil)
 			}
 			return err
 		}
 
+		if c.RemoteState {
+			p, err := getProvider(ctx, c)
+			if err != nil {
+				return err
+			}
+			if err := syncRemoteState(c, p); err != nil {
+				return err
+			}
+		}
+
+		if consulTokenRole != "" {
+			c.ConsulTokenRole = consulTokenRole
+		}
 		log.Info().Msgf("[%s] running status on project %s", c.Status, c.Name)
 
+		if serveAddr != "" {
+			return serveMetrics(ctx, c, serveAddr, pollReport, watchInterval)
+		}
+		if watch {
+			return watchStatus(ctx, os.Stdout, c, pollReport, watchInterval, isTerminal(os.Stdout))
+		}
+
 		r := cli.NewReport(c)
+		r.AcceptStandby = vaultStandbyOK
+		r.Timeout = toolCheckTimeout
+		r.ReadConsulToken = c.ConsulTokenRole != ""
 		if c.Status >= cli.InfraDeployDone {
-			if err := r.CheckStatus(ctx); err != nil {
-				return err
+			if waitReady {
+				for _, t := range r.Targets {
+					if err := waitForStatus(ctx, c, t); err != nil {
+						return err
+					}
+				}
 			}
+			r.CheckStatus(ctx)
 		}
-		r.PrintReport()
-
-		return nil
+		return printStatus(r.Document(), r)
 	},
 }
 
+// printStatus writes the report in the selected output format.
+func printStatus(d cli.StatusDocument, r *cli.Report) error {
+	switch output {
+	case "json":
+		return d.PrintJSON(os.Stdout)
+	case "yaml":
+		return d.PrintYAML(os.Stdout)
+	}
+	if r != nil {
+		r.PrintReport()
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVar(&waitReady, FlagWait, false, "wait for the tools to be available before reporting")
+	statusCmd.Flags().BoolVar(&watch, FlagWatch, false, "refresh the health of the tools until interrupted, printing a JSON line per change when not on a terminal")
+	statusCmd.Flags().DurationVar(&watchInterval, FlagInterval, 5*time.Second, "interval between the refreshes of --watch and --serve")
+	statusCmd.Flags().StringVar(&serveAddr, FlagServe, "", "serve the health of the tools as Prometheus metrics on the given address (e.g. :9100) until interrupted")
+	statusCmd.Flags().DurationVar(&toolCheckTimeout, FlagCheckTimeout, cli.DefaultCheckTimeout, "maximum time each tool is given to answer the checks")
+	statusCmd.Flags().BoolVar(&vaultStandbyOK, FlagVaultStandbyOK, false, "report vault as available when the node answering is a standby")
+	statusCmd.Flags().StringVar(&consulTokenRole, FlagConsulTokenRole, "", "role of the vault consul secrets engine issuing a token when the one of the project is missing or denied")
+	statusCmd.Flags().StringVarP(&output, FlagOutput, FlagOutputShort, "text", "output format: text, json or yaml")
+	addTimeoutFlags(statusCmd, cli.Vault, cli.Consul, cli.Nomad)
 }
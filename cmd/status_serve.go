@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/exporter"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// serveMetrics polls the tools every interval and serves the results as Prometheus metrics on the
+// given address until the context is cancelled.
+func serveMetrics(ctx context.Context, c *cli.Config, addr string, poll pollFunc, interval time.Duration) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+	return serveMetricsOn(ctx, l, c, poll, interval)
+}
+
+func serveMetricsOn(ctx context.Context, l net.Listener, c *cli.Config, poll pollFunc, interval time.Duration) error {
+	e := exporter.New(c.Name)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "caravan exporter of project %s: metrics at /metrics\n", c.Name)
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(l)
+	}()
+	log.Info().Msgf("serving the metrics of project %s on http://%s/metrics", c.Name, l.Addr())
+
+	for {
+		c = reloadProject(c)
+		tools := poll(ctx, c)
+		if ctx.Err() == nil {
+			e.Update(c.Status, cli.NewReport(c).Targets, tools, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(sctx); err != nil {
+				return err
+			}
+			log.Info().Msgf("stopped serving the metrics of project %s", c.Name)
+			return nil
+		case err := <-served:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
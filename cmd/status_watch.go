@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog/log"
+)
+
+// maxRecentChanges is the number of transitions listed by the dashboard.
+const maxRecentChanges = 10
+
+const (
+	ansiClear = "\033[H\033[2J"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiReset = "\033[0m"
+)
+
+// isTerminal tells whether the file is a terminal.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// pollFunc checks the tools of the project.
+type pollFunc func(ctx context.Context, c *cli.Config) map[string]cli.Tool
+
+// pollReport checks the tools with the checkers of the report.
+func pollReport(ctx context.Context, c *cli.Config) map[string]cli.Tool {
+	if c.Status < cli.InfraDeployDone {
+		return map[string]cli.Tool{}
+	}
+	r := cli.NewReport(c)
+	r.AcceptStandby = vaultStandbyOK
+	r.Timeout = toolCheckTimeout
+	return r.Poll(ctx)
+}
+
+// reloadProject reads the state of the project again, as it may be operated on by another process
+// meanwhile. The given config is returned when it cannot be read.
+func reloadProject(c *cli.Config) *cli.Config {
+	cur, err := cli.NewConfigFromFile(c.Name)
+	if err != nil {
+		log.Debug().Msgf("unable to reload project %s: %s", c.Name, err)
+		return c
+	}
+	return cur
+}
+
+// watchStatus polls the tools every interval until the context is cancelled. On a terminal a
+// dashboard is redrawn after each poll, otherwise a JSON line is printed for each change.
+func watchStatus(ctx context.Context, out io.Writer, c *cli.Config, poll pollFunc, interval time.Duration, tty bool) error {
+	var prev map[string]cli.Tool
+	var recent []cli.ToolChange
+	enc := json.NewEncoder(out)
+	stopped := func() error {
+		if tty {
+			fmt.Fprintln(out, "\nstopped watching")
+		}
+		return nil
+	}
+	for {
+		c = reloadProject(c)
+		targets := cli.NewReport(c).Targets
+
+		tools := poll(ctx, c)
+		if ctx.Err() != nil {
+			return stopped()
+		}
+		now := time.Now()
+		changes := cli.ToolChanges(targets, prev, tools, now)
+		prev = tools
+
+		if tty {
+			recent = append(recent, changes...)
+			if len(recent) > maxRecentChanges {
+				recent = recent[len(recent)-maxRecentChanges:]
+			}
+			if err := renderDashboard(out, c, targets, tools, changes, recent, interval, now); err != nil {
+				return err
+			}
+		} else {
+			for _, ch := range changes {
+				if err := enc.Encode(ch); err != nil {
+					return err
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return stopped()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// renderDashboard redraws the health of the tools, highlighting the ones that just changed.
+func renderDashboard(out io.Writer, c *cli.Config, targets []string, tools map[string]cli.Tool, changes, recent []cli.ToolChange, interval time.Duration, now time.Time) error {
+	changed := map[string]bool{}
+	for _, ch := range changes {
+		changed[ch.Tool] = true
+	}
+
+	fmt.Fprint(out, ansiClear)
+	fmt.Fprintf(out, "%s%s%s  %s  refreshed %s, every %s (Ctrl-C to stop)\n\n",
+		ansiBold, c.Name, ansiReset, c.Status.Name(), now.Format("15:04:05"), interval)
+
+	// fixed width columns, as the escape sequences would be counted by a tabwriter
+	row := "%-8s %s%-14s%s %-12s %-9s %s\n"
+	fmt.Fprintf(out, row, "TOOL", "", "STATE", "", "VERSION", "LATENCY", "DETAIL")
+	for _, t := range targets {
+		tool, ok := tools[t]
+		if !ok {
+			fmt.Fprintf(out, row, t, "", "-", "", "-", "-", "not checked")
+			continue
+		}
+		color := ansiRed
+		if tool.Status {
+			color = ansiGreen
+		}
+		if changed[t] {
+			color += ansiBold
+		}
+		if _, err := fmt.Fprintf(out, row, t, color, tool.Health.State, ansiReset,
+			tool.Version, tool.Health.Latency.Round(time.Millisecond), tool.Health.Reason); err != nil {
+			return err
+		}
+	}
+
+	if len(recent) > 0 {
+		fmt.Fprintln(out, "\nRecent changes:")
+		for _, ch := range recent {
+			from := ch.From
+			if from == "" {
+				from = "-"
+			}
+			fmt.Fprintf(out, "  %s  %-7s %s -> %s\n", ch.Time.Format("15:04:05"), ch.Tool, from, ch.To)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Unlock command.
+//
+// Copyright © 2021 Bitrock s.r.l. <devops@bitrock.it>
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/provider"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var direct = false
+
+// unlockCmd represents the unlock command.
+var unlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "List and release the terraform state locks left by interrupted runs",
+	Long: `Lists the locks held on the terraform state of the layers, with the process holding them.
+With --force the locks are released with terraform force-unlock or, with --direct, by removing them
+from the terraform backend (the DynamoDB lock table, the GCS lock files or the Azure blob leases).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cli.NewConfigFromFile(name)
+		if err != nil {
+			if errors.As(err, &cli.ConfigFileNotFound{}) {
+				log.Info().Msgf("please run init")
+				return nil
+			}
+			return err
+		}
+		c.LogLevel = logLevel
+		layers, _, err := selectLayers(layerNames, fromLayer, toLayer, false)
+		if err != nil {
+			return err
+		}
+
+		prv, err := getProvider(ctx, c)
+		if err != nil {
+			return err
+		}
+		if err := syncRemoteState(c, prv); err != nil {
+			return err
+		}
+		// the project lease makes sure no caravan process is running terraform on the project
+		if err := lockProject(c, "unlock", false); err != nil {
+			return err
+		}
+		defer unlockProject(c)
+
+		all, err := prv.StateLocks(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing terraform state locks: %w", err)
+		}
+		locks := []provider.StateLock{}
+		for _, l := range all {
+			for _, s := range layers {
+				if l.Layer == s {
+					locks = append(locks, l)
+				}
+			}
+		}
+		if len(locks) == 0 {
+			log.Info().Msgf("[%s] no terraform state lock held on project %s", c.Status, c.Name)
+			return nil
+		}
+		if err := printStateLocks(os.Stdout, locks); err != nil {
+			return err
+		}
+		if !force {
+			log.Info().Msgf("[%s] run with --%s to release the locks", c.Status, FlagForce)
+			return nil
+		}
+
+		if !direct {
+			if err := setUpTerraform(c); err != nil {
+				return err
+			}
+		}
+		for _, l := range locks {
+			if direct {
+				err = prv.ReleaseStateLock(ctx, l)
+			} else {
+				err = prv.ForceUnlock(ctx, l)
+			}
+			if err != nil {
+				return err
+			}
+			log.Info().Msgf("[%s] released lock %s of layer %s", c.Status, l.ID, l.Layer)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unlockCmd)
+
+	unlockCmd.Flags().BoolVarP(&force, FlagForce, FlagForceShort, false, "release the locks listed")
+	unlockCmd.Flags().BoolVar(&direct, FlagDirect, false, "remove the locks from the terraform backend instead of running terraform force-unlock")
+	addLayerFlags(unlockCmd, "unlock")
+}
+
+// printStateLocks writes the locks as a table.
+func printStateLocks(w io.Writer, locks []provider.StateLock) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "LAYER\tID\tOPERATION\tWHO\tCREATED\tPATH")
+	for _, l := range locks {
+		created := ""
+		if !l.Created.IsZero() {
+			created = l.Created.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", l.Layer, l.ID, l.Operation, l.Who, created, l.Path)
+	}
+	return tw.Flush()
+}
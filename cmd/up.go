@@ -4,12 +4,13 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
-	"time"
 
 	"caravan-cli/cli"
-	"caravan-cli/cli/checker"
+	"caravan-cli/git"
+	"caravan-cli/provider"
 
 	"github.com/rs/zerolog/log"
 
@@ -22,170 +23,156 @@ var upCmd = &cobra.Command{
 	Short: "Deploy the caravan infra",
 	Long:  `This commands applies the generated terraform configs and provision the needed infrastructure to deploy a caravan instance`,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
-		c, err := cli.NewConfigFromFile()
+		if err := bindTimeoutFlags(cmd); err != nil {
+			return err
+		}
+		c, err := cli.NewConfigFromFile(name)
 		if err != nil {
 			log.Error().Msgf("ERR: %s", err)
-			if strings.Contains(err.Error(), "no such file or directory") {
+			if errors.As(err, &cli.ConfigFileNotFound{}) {
 				log.Info().Msgf("please run init")
 				return nil
 			}
 			return err
 		}
 		c.LogLevel = logLevel
+		c.UseSavedPlan = savedPlan
 
-		target := cli.ApplicationDeployDone
+		layers, selected, err := selectLayers(layerNames, fromLayer, toLayer, false)
+		if err != nil {
+			return err
+		}
+		target := layers[len(layers)-1].Deployed()
 		log.Info().Msgf("[%s->%s] running up on project %s", c.Status, target, c.Name)
 		prv, err := getProvider(ctx, c)
 		if err != nil {
 			return err
 		}
-		if c.Status < cli.InfraDeployDone {
-			log.Info().Msgf("[%s->%s] infrastructure deployment starting", c.Status, target)
-			c.SaveStatus(cli.InfraDeployRunning)
-
-			err := prv.Deploy(ctx, cli.Infrastructure)
-			if err != nil {
-				return err
-			}
-
-			c.SaveStatus(cli.InfraDeployDone)
-			log.Info().Msgf("[%s->%s] infrastructure deployment completed", c.Status, target)
+		if err := syncRemoteState(c, prv); err != nil {
+			return err
 		}
-		if c.Status < cli.InfraCheckDone {
-			log.Info().Msgf("[%s->%s] infrastructure check starting", c.Status, target)
-			if err := checkStatus(c, "vault", 30); err != nil {
-				return err
+		if err := lockProject(c, "up", true); err != nil {
+			return err
+		}
+		defer unlockProject(c)
+		if consulTokenRole != "" {
+			c.ConsulTokenRole = consulTokenRole
+		}
+		if err := setUpTerraform(c); err != nil {
+			return err
+		}
+		for _, l := range layers {
+			if l == cli.ApplicationSupport && !c.DeployNomad {
+				if selected {
+					log.Info().Msgf("[%s->%s] skipping application layer: nomad is not deployed", c.Status, target)
+				}
+				continue
 			}
-			if err := checkStatus(c, "consul", 30); err != nil {
+			if err := c.Deployable(l); err != nil {
 				return err
 			}
-			if c.DeployNomad {
-				if err := checkStatus(c, "nomad", 30); err != nil {
-					return err
-				}
-			}
-			c.SaveStatus(cli.InfraCheckDone)
-
-			log.Debug().Msgf("setting Vault root token")
-			if c.VaultRootToken == "" {
-				if err := c.SetVaultRootToken(); err != nil {
-					return fmt.Errorf("error setting Vault root Token: %w", err)
-				}
+			if selected && c.Layer(l).State == cli.LayerReady {
+				log.Info().Msgf("[%s->%s] applying again %s layer", c.Status, target, l)
 			}
-			if c.DeployNomad {
-				if c.NomadToken == "" {
-					log.Debug().Msgf("setting Nomad token")
-					if err := c.SetNomadToken(); err != nil {
-						return fmt.Errorf("error setting Nomad token: %w", err)
-					}
-				}
+			if err := upLayer(c, prv, l, target, selected); err != nil {
+				c.SaveLayerError(l, err)
+				return err
 			}
-			c.Save()
-			log.Info().Msgf("[%s->%s] infrastructure check done", c.Status, target)
 		}
-		if c.Status < cli.PlatformDeployDone {
+		log.Info().Msgf("[%s->%s] current status", c.Status, target)
+		return nil
+	},
+}
 
-			log.Info().Msgf("[%s->%s] platform deployment starting", c.Status, target)
-			c.SaveStatus(cli.PlatformDeployRunning)
+// upLayer deploys and checks the given layer, resuming from its current state unless it is applied again.
+func upLayer(c *cli.Config, prv provider.Provider, l cli.DeployLayer, target cli.Status, again bool) error {
+	state := c.Layer(l).State
+	if again || (state != cli.LayerApplied && state != cli.LayerChecking && state != cli.LayerReady) {
+		log.Info().Msgf("[%s->%s] %s deployment starting", c.Status, target, l)
+		c.SaveLayerState(l, cli.LayerApplying)
 
-			err := prv.Deploy(ctx, cli.Platform)
-			if err != nil {
-				return err
-			}
+		if err := prv.Deploy(ctx, l); err != nil {
+			return err
+		}
 
-			c.SaveStatus(cli.PlatformDeployDone)
-			log.Info().Msgf("[%s->%s] platform deployment completed", c.Status, target)
+		commit, err := git.Head(c.LayerWorkdir(l))
+		if err != nil {
+			log.Debug().Msgf("unable to read the commit of layer %s: %s", l, err)
 		}
-		if c.Status < cli.PlatformConsulDeployDone {
-			log.Info().Msgf("[%s->%s] consul deployment check", c.Status, target)
-			c.SaveStatus(cli.PlatformConsulDeployRunning)
-			if err := checkURL(c, "consul", "/v1/connect/ca/roots", 60); err != nil {
-				return err
-			}
-			c.SaveStatus(cli.PlatformConsulDeployDone)
-			log.Info().Msgf("[%s->%s] consul checks completed", c.Status, target)
+		c.SaveLayerApplied(l, c.TerraformVersion, commit)
+		log.Info().Msgf("[%s->%s] %s deployment completed", c.Status, target, l)
+	}
+	if c.Layer(l).State == cli.LayerReady {
+		return nil
+	}
+	switch l {
+	case cli.Infrastructure:
+		log.Info().Msgf("[%s->%s] infrastructure check starting", c.Status, target)
+		c.SaveLayerState(l, cli.LayerChecking)
+		if err := readInfraOutputs(c, prv); err != nil {
+			return err
+		}
+		if err := waitForStatus(ctx, c, cli.Vault); err != nil {
+			return err
+		}
+		if err := waitForStatus(ctx, c, cli.Consul); err != nil {
+			return err
 		}
-
 		if c.DeployNomad {
-			if c.Status < cli.ApplicationDeployDone {
-				log.Info().Msgf("[%s->%s] application deployment starting", c.Status, target)
-				c.SaveStatus(cli.ApplicationDeployRunning)
-
-				err := prv.Deploy(ctx, cli.ApplicationSupport)
-				if err != nil {
-					return err
+			if err := waitForStatus(ctx, c, cli.Nomad); err != nil {
+				return err
+			}
+			if c.NomadToken == "" {
+				log.Debug().Msgf("setting Nomad token")
+				if err := c.SetNomadToken(); err != nil {
+					return fmt.Errorf("error setting Nomad token: %w", err)
 				}
-
-				c.SaveStatus(cli.ApplicationDeployDone)
-				log.Info().Msgf("[%s->%s] deployment of application completed", c.Status, target)
 			}
 		}
-		log.Info().Msgf("[%s->%s] current status", c.Status, target)
-		return nil
-	},
+		log.Info().Msgf("[%s->%s] infrastructure check done", c.Status, target)
+	case cli.Platform:
+		log.Info().Msgf("[%s->%s] consul deployment check", c.Status, target)
+		c.SaveLayerState(l, cli.LayerChecking)
+		if err := waitForURL(ctx, c, ConsulConnect, cli.Consul, "/v1/connect/ca/roots"); err != nil {
+			return err
+		}
+		if c.ConsulToken == "" && c.ConsulTokenRole != "" {
+			// only used to report the consul details, the version is scraped from the UI without it
+			if err := c.SetConsulToken(); err != nil {
+				log.Warn().Msgf("unable to read a consul token from vault: %s", err)
+			}
+		}
+		log.Info().Msgf("[%s->%s] consul checks completed", c.Status, target)
+	}
+	c.SaveLayerState(l, cli.LayerReady)
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(upCmd)
+
+	upCmd.Flags().BoolVar(&savedPlan, FlagSavedPlan, false, "apply the plans previously saved by the plan command")
+	upCmd.Flags().BoolVar(&vaultStandbyOK, FlagVaultStandbyOK, false, "consider vault available when the node answering is a standby")
+	upCmd.Flags().StringVar(&consulTokenRole, FlagConsulTokenRole, "", "role of the vault consul secrets engine issuing the token used to read the consul details, saved in the project")
+	addTimeoutFlags(upCmd, cli.Vault, cli.Consul, cli.Nomad, ConsulConnect)
+	addLayerFlags(upCmd, "apply")
+	addResumeFlags(upCmd)
 }
 
-func checkURL(c *cli.Config, tool, path string, count int) (err error) {
-	tls, err := checker.TLSClient(c.CAPath)
+// readInfraOutputs fills the config with the endpoints, CA bundle and Vault root token
+// reported by the infrastructure layer.
+func readInfraOutputs(c *cli.Config, p provider.Provider) error {
+	outputs, err := p.Outputs(ctx, cli.Infrastructure)
 	if err != nil {
 		return err
 	}
-
-	checker := checker.NewGenericChecker(fmt.Sprintf("https://%s.%s.%s", tool, c.Name, c.Domain), tls)
-	for i := 0; i <= count; i++ {
-		if checker.CheckURL(ctx, path) {
-			log.Info().Msgf("OK")
-			break
-		}
-		if i >= count {
-			log.Warn().Msgf("KO")
-			return fmt.Errorf("timeout waiting for %s to be available", tool)
-		}
-		time.Sleep(6 * time.Second)
-		log.Info().Msgf(".")
-	}
-	return nil
-}
-
-func checkStatus(c *cli.Config, tool string, count int) (err error) {
-	log.Info().Msgf("checking %s status:", tool)
-
-	var check checker.Checker
-	switch tool {
-	case cli.Nomad:
-		check, err = checker.NewNomadChecker(fmt.Sprintf("https://%s.%s.%s", tool, c.Name, c.Domain), c.CAPath)
-		if err != nil {
-			return err
-		}
-	case cli.Consul:
-		check, err = checker.NewConsulChecker(fmt.Sprintf("https://%s.%s.%s", tool, c.Name, c.Domain), c.CAPath)
-		if err != nil {
-			return err
-		}
-	case cli.Vault:
-		check, err = checker.NewVaultChecker(fmt.Sprintf("https://%s.%s.%s", tool, c.Name, c.Domain), c.CAPath)
-		if err != nil {
-			return err
-		}
-	default:
-		log.Error().Msgf("tool not supported: %s", tool)
+	values := map[string]json.RawMessage{}
+	for k, v := range outputs {
+		values[k] = v.Value
 	}
-
-	for i := 0; i < count; i++ {
-		if check.Status(ctx) {
-			log.Info().Msgf("checking %s status: OK", tool)
-			break
-		}
-		if i >= count {
-			log.Warn().Msgf("checking %s status: KO", tool)
-			return fmt.Errorf("timeout waiting for %s to be available", tool)
-		}
-		time.Sleep(6 * time.Second)
-		fmt.Printf(".")
+	if err := c.SetInfraOutputs(values); err != nil {
+		return fmt.Errorf("error reading infra outputs: %w", err)
 	}
+	c.Save()
 	return nil
 }
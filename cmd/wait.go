@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/cli/checker"
+	"caravan-cli/wait"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// ConsulConnect is the key of the timeout waiting for the Consul Connect CA to be available.
+const ConsulConnect = "consul-connect"
+
+// defaultTimeouts are the per check timeouts used when neither a flag nor the config file sets them.
+var defaultTimeouts = map[string]time.Duration{
+	cli.Vault:     3 * time.Minute,
+	cli.Consul:    3 * time.Minute,
+	cli.Nomad:     3 * time.Minute,
+	ConsulConnect: 6 * time.Minute,
+}
+
+// addTimeoutFlags adds to the command the flags configuring the timeouts of the given checks.
+func addTimeoutFlags(cmd *cobra.Command, checks ...string) {
+	for _, t := range checks {
+		cmd.Flags().Duration(t+"-timeout", defaultTimeouts[t], fmt.Sprintf("maximum time to wait for %s to be available (config key timeouts.%s)", t, t))
+	}
+}
+
+// bindTimeoutFlags binds the timeout flags of the running command to the timeouts section of the
+// config file, the flags taking precedence when set.
+func bindTimeoutFlags(cmd *cobra.Command) error {
+	for t := range defaultTimeouts {
+		f := cmd.Flags().Lookup(t + "-timeout")
+		if f == nil {
+			continue
+		}
+		if err := viper.BindPFlag("timeouts."+t, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTimeout(check string) time.Duration {
+	if viper.IsSet("timeouts." + check) {
+		return viper.GetDuration("timeouts." + check)
+	}
+	return defaultTimeouts[check]
+}
+
+// newChecker builds the checker of the given tool.
+var newChecker = func(c *cli.Config, tool string) (checker.Checker, error) {
+	switch tool {
+	case cli.Nomad:
+		nc, err := checker.NewNomadChecker(c.Endpoint(tool), c.CAPath)
+		nc.Token = c.NomadToken
+		return nc, err
+	case cli.Consul:
+		cc, err := checker.NewConsulChecker(c.Endpoint(tool), c.CAPath)
+		cc.Token = c.ConsulToken
+		return cc, err
+	case cli.Vault:
+		vc, err := checker.NewVaultChecker(c.Endpoint(tool), c.CAPath)
+		vc.AcceptStandby = vaultStandbyOK
+		return vc, err
+	default:
+		return nil, fmt.Errorf("tool not supported: %s", tool)
+	}
+}
+
+// waitFor polls the condition with the timeout configured for the given check, logging the progress.
+func waitFor(ctx context.Context, check string, cond wait.Condition) error {
+	timeout := checkTimeout(check)
+	log.Info().Msgf("waiting up to %s for %s to be available", timeout, check)
+	err := wait.Poll(ctx, wait.Options{
+		Timeout: timeout,
+		OnAttempt: func(a wait.Attempt) {
+			log.Info().Msgf("%s not available yet (attempt %d, %s elapsed), retrying in %s",
+				check, a.Number, a.Elapsed.Round(time.Second), a.Next.Round(time.Second))
+		},
+	}, cond)
+	if errors.As(err, &wait.TimeoutError{}) {
+		log.Warn().Msgf("checking %s status: KO", check)
+		return fmt.Errorf("timeout waiting for %s to be available: %w", check, err)
+	}
+	if err != nil {
+		return err
+	}
+	log.Info().Msgf("checking %s status: OK", check)
+	return nil
+}
+
+func waitForStatus(ctx context.Context, c *cli.Config, tool string) error {
+	check, err := newChecker(c, tool)
+	if err != nil {
+		return err
+	}
+	hc, ok := check.(checker.HealthChecker)
+	if !ok {
+		return waitFor(ctx, tool, func(ctx context.Context) (bool, error) {
+			return check.Status(ctx), nil
+		})
+	}
+	var last checker.HealthResult
+	err = waitFor(ctx, tool, func(ctx context.Context) (bool, error) {
+		h := hc.Health(ctx)
+		if h.State != last.State {
+			log.Info().Msgf("%s is %s", tool, h)
+		}
+		last = h
+		return h.Ready(vaultStandbyOK), nil
+	})
+	if err != nil && last.State != "" {
+		return fmt.Errorf("%w (last %s)", err, last)
+	}
+	return err
+}
+
+// urlChecker checks that a path of a tool endpoint is available.
+type urlChecker interface {
+	CheckURL(ctx context.Context, path string) bool
+}
+
+// newURLChecker builds the url checker of the given tool.
+var newURLChecker = func(c *cli.Config, tool string) (urlChecker, error) {
+	tls, err := checker.TLSClient(c.CAPath)
+	if err != nil {
+		return nil, err
+	}
+	return checker.NewGenericChecker(c.Endpoint(tool), tls), nil
+}
+
+func waitForURL(ctx context.Context, c *cli.Config, check, tool, path string) error {
+	gc, err := newURLChecker(c, tool)
+	if err != nil {
+		return err
+	}
+	return waitFor(ctx, check, func(ctx context.Context) (bool, error) {
+		return gc.CheckURL(ctx, path), nil
+	})
+}
@@ -0,0 +1,211 @@
+package doctor
+
+import (
+	"caravan-cli/git"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/oauth2/google"
+	"gopkg.in/ini.v1"
+)
+
+// missing is the status of a check of something that is not available: a failure when it is
+// required, a warning otherwise.
+func missing(required bool) Status {
+	if required {
+		return Fail
+	}
+	return Warn
+}
+
+// Terraform checks that the terraform binary is available and reports its version. The binary
+// installed by caravan at the given path is checked when not empty, the one in $PATH otherwise.
+func Terraform(path string) Check {
+	return Check{
+		Name: "terraform",
+		Run: func(ctx context.Context) (Status, string) {
+			if path != "" {
+				if _, err := os.Stat(path); err != nil {
+					return Warn, fmt.Sprintf("pinned terraform not installed yet in %s: it will be on first use", filepath.Dir(path))
+				}
+			} else {
+				var err error
+				if path, err = exec.LookPath("terraform"); err != nil {
+					return Fail, "terraform binary not found in $PATH"
+				}
+			}
+			out, err := exec.CommandContext(ctx, path, "version", "-json").Output()
+			if err != nil {
+				return Fail, fmt.Sprintf("error running %s version: %s", path, err)
+			}
+			v := struct {
+				Version  string `json:"terraform_version"`
+				Outdated bool   `json:"terraform_outdated"`
+			}{}
+			if err := json.Unmarshal(out, &v); err != nil {
+				return Warn, fmt.Sprintf("unable to parse the version of %s: %s", path, err)
+			}
+			if v.Outdated {
+				return Warn, fmt.Sprintf("terraform %s at %s is outdated", v.Version, path)
+			}
+			return Pass, fmt.Sprintf("terraform %s at %s", v.Version, path)
+		},
+	}
+}
+
+// GitRepos checks that the given repos of the organization can be reached.
+func GitRepos(org string, repos []string) Check {
+	return Check{
+		Name: "git",
+		Run: func(ctx context.Context) (Status, string) {
+			g := git.NewGit(org, "")
+			for _, r := range repos {
+				if err := g.Reachable(ctx, r); err != nil {
+					return Fail, err.Error()
+				}
+			}
+			return Pass, fmt.Sprintf("%d repos reachable on github.com/%s", len(repos), org)
+		},
+	}
+}
+
+// AWSCredentials checks that the AWS SDK default chain resolves credentials.
+func AWSCredentials(required bool) Check {
+	return Check{
+		Name: "aws credentials",
+		Run: func(ctx context.Context) (Status, string) {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			if err != nil {
+				return missing(required), fmt.Sprintf("unable to load the AWS config: %s", err)
+			}
+			creds, err := cfg.Credentials.Retrieve(ctx)
+			if err != nil {
+				return missing(required), fmt.Sprintf("unable to resolve AWS credentials: %s", err)
+			}
+			region := cfg.Region
+			if region == "" {
+				region = "no default region"
+			}
+			return Pass, fmt.Sprintf("credentials from %s, %s", creds.Source, region)
+		},
+	}
+}
+
+// GCPCredentials checks the gcloud default configuration and the application default credentials.
+func GCPCredentials(required bool) Check {
+	return Check{
+		Name: "gcp credentials",
+		Run: func(ctx context.Context) (Status, string) {
+			path := filepath.Join(os.Getenv("HOME"), ".config/gcloud/configurations/config_default")
+			f, err := ini.Load(path)
+			if err != nil {
+				return missing(required), fmt.Sprintf("unable to read the gcloud configuration: %s", err)
+			}
+			account := f.Section("core").Key("account").String()
+			if account == "" {
+				return missing(required), fmt.Sprintf("no account set in %s: please run gcloud auth login", path)
+			}
+			if _, err := google.FindDefaultCredentials(ctx); err != nil {
+				return missing(required), "no application default credentials: please run gcloud auth application-default login"
+			}
+			return Pass, fmt.Sprintf("account %s", account)
+		},
+	}
+}
+
+// AzureCredentials checks that a token for the Azure resource manager can be obtained, either
+// from the Azure CLI or from the environment.
+func AzureCredentials(useCLI, required bool) Check {
+	return Check{
+		Name: "azure credentials",
+		Run: func(ctx context.Context) (Status, string) {
+			var cred azcore.TokenCredential
+			var err error
+			source := "environment"
+			if useCLI {
+				source = "Azure CLI"
+				cred, err = azidentity.NewAzureCLICredential(nil)
+			} else {
+				cred, err = azidentity.NewEnvironmentCredential(nil)
+			}
+			if err != nil {
+				return missing(required), fmt.Sprintf("no credentials from the %s: %s", source, err)
+			}
+			_, err = cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}})
+			if err != nil {
+				return missing(required), fmt.Sprintf("unable to get a token from the %s: %s", source, firstLine(err.Error()))
+			}
+			return Pass, fmt.Sprintf("token from the %s", source)
+		},
+	}
+}
+
+// DNS checks that the domain resolves.
+func DNS(domain string) Check {
+	return Check{
+		Name: "dns",
+		Run: func(ctx context.Context) (Status, string) {
+			if domain == "" {
+				return Warn, "no domain to check"
+			}
+			ns, err := net.DefaultResolver.LookupNS(ctx, domain)
+			if err != nil || len(ns) == 0 {
+				return Fail, fmt.Sprintf("unable to resolve the name servers of %s: %s", domain, err)
+			}
+			hosts := []string{}
+			for _, n := range ns {
+				hosts = append(hosts, strings.TrimSuffix(n.Host, "."))
+			}
+			return Pass, fmt.Sprintf("%s served by %s", domain, strings.Join(hosts, ", "))
+		},
+	}
+}
+
+// Workdir checks that the caravan working directory is writable or, when missing, that it can be
+// created in its nearest existing parent. Nothing is created.
+func Workdir(dir string) Check {
+	return Check{
+		Name: "workdir",
+		Run: func(ctx context.Context) (Status, string) {
+			path := dir
+			for {
+				info, err := os.Stat(path)
+				if errors.Is(err, os.ErrNotExist) && filepath.Dir(path) != path {
+					path = filepath.Dir(path)
+					continue
+				}
+				if err != nil {
+					return Fail, fmt.Sprintf("unable to read %s: %s", path, err)
+				}
+				if !info.IsDir() {
+					return Fail, fmt.Sprintf("%s is not a directory", path)
+				}
+				if err := writable(path, info); err != nil {
+					return Fail, fmt.Sprintf("unable to write in %s: %s", path, err)
+				}
+				if path != dir {
+					return Pass, fmt.Sprintf("%s can be created in %s", dir, path)
+				}
+				return Pass, fmt.Sprintf("%s is writable", dir)
+			}
+		},
+	}
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
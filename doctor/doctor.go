@@ -0,0 +1,79 @@
+// Doctor runs the preflight checks of the environment caravan depends on.
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Check is a named preflight check.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (Status, string)
+}
+
+// Result is the outcome of a check along with a message explaining it.
+type Result struct {
+	Check   string `json:"check"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report holds the results of the checks in the order they were run.
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Run executes the checks one after the other, each one bounded by the given timeout.
+func Run(ctx context.Context, checks []Check, timeout time.Duration) (r Report) {
+	for _, c := range checks {
+		cctx, cancel := context.WithTimeout(ctx, timeout)
+		status, msg := c.Run(cctx)
+		if cctx.Err() != nil && status != Pass {
+			status, msg = Fail, fmt.Sprintf("%s (%s)", msg, cctx.Err())
+		}
+		cancel()
+		r.Results = append(r.Results, Result{Check: c.Name, Status: status, Message: msg})
+	}
+	return r
+}
+
+// Failed reports whether any of the checks failed.
+func (r Report) Failed() bool {
+	for _, res := range r.Results {
+		if res.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintTable writes the results as a table.
+func (r Report) PrintTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tMESSAGE")
+	for _, res := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", res.Check, res.Status, res.Message)
+	}
+	return tw.Flush()
+}
+
+// PrintJSON writes the results as a JSON document.
+func (r Report) PrintJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
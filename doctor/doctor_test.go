@@ -0,0 +1,70 @@
+package doctor_test
+
+import (
+	"bytes"
+	"caravan-cli/doctor"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func fixed(name string, s doctor.Status) doctor.Check {
+	return doctor.Check{Name: name, Run: func(ctx context.Context) (doctor.Status, string) {
+		return s, string(s)
+	}}
+}
+
+func TestRun(t *testing.T) {
+	slow := doctor.Check{Name: "slow", Run: func(ctx context.Context) (doctor.Status, string) {
+		<-ctx.Done()
+		return doctor.Warn, "gave up"
+	}}
+	dir := filepath.Join(t.TempDir(), ".caravan")
+	checks := []doctor.Check{fixed("ok", doctor.Pass), fixed("meh", doctor.Warn), slow, doctor.Workdir(dir), doctor.DNS("")}
+
+	r := doctor.Run(context.Background(), checks, 10*time.Millisecond)
+
+	want := []doctor.Status{doctor.Pass, doctor.Warn, doctor.Fail, doctor.Pass, doctor.Warn}
+	if len(r.Results) != len(want) {
+		t.Fatalf("got %d results but wanted %d", len(r.Results), len(want))
+	}
+	for i, res := range r.Results {
+		if res.Check != checks[i].Name || res.Status != want[i] {
+			t.Errorf("got %s: %s but wanted %s: %s", res.Check, res.Status, checks[i].Name, want[i])
+		}
+	}
+	if !r.Failed() {
+		t.Errorf("report with a failed check not reported as failed")
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("workdir created by the check")
+	}
+	if doctor.Run(context.Background(), checks[:2], time.Second).Failed() {
+		t.Errorf("report without failed checks reported as failed")
+	}
+
+	var table bytes.Buffer
+	if err := r.PrintTable(&table); err != nil {
+		t.Fatalf("error printing table: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(table.String()), "\n"); len(lines) != len(want)+1 {
+		t.Errorf("got %d table lines but wanted %d:\n%s", len(lines), len(want)+1, table.String())
+	}
+
+	var js bytes.Buffer
+	if err := r.PrintJSON(&js); err != nil {
+		t.Fatalf("error printing json: %s", err)
+	}
+	got := doctor.Report{}
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatalf("error parsing json: %s", err)
+	}
+	if len(got.Results) != len(want) || got.Results[2].Status != doctor.Fail {
+		t.Errorf("unexpected json report: %s", js.String())
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package doctor
+
+import (
+	"os"
+	"syscall"
+)
+
+// wOK is the W_OK mode of access(2).
+const wOK = 0x2
+
+// writable tells whether the process can create files in the directory.
+func writable(dir string, info os.FileInfo) error {
+	return syscall.Access(dir, wOK)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package doctor
+
+import (
+	"errors"
+	"os"
+)
+
+// writable tells whether the directory is not read-only.
+func writable(dir string, info os.FileInfo) error {
+	if info.Mode().Perm()&0o200 == 0 {
+		return errors.New("read-only directory")
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Exporter exposes the health of the caravan tools as Prometheus metrics.
+package exporter
+
+import (
+	"bytes"
+	"caravan-cli/cli"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Exporter keeps the results of the last checks of a project and renders them as metrics.
+type Exporter struct {
+	mu          sync.Mutex
+	project     string
+	status      string
+	targets     []string
+	tools       map[string]cli.Tool
+	lastSuccess map[string]time.Time
+	checks      map[string]uint64
+	failures    map[string]uint64
+}
+
+// New returns an exporter of the given project.
+func New(project string) *Exporter {
+	return &Exporter{
+		project:     project,
+		tools:       map[string]cli.Tool{},
+		lastSuccess: map[string]time.Time{},
+		checks:      map[string]uint64{},
+		failures:    map[string]uint64{},
+	}
+}
+
+// Update records the results of a check of the tools of the project, in the given status.
+func (e *Exporter) Update(status cli.Status, targets []string, tools map[string]cli.Tool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status.Name()
+	e.targets = append([]string{}, targets...)
+	e.tools = tools
+	for t, tool := range tools {
+		e.checks[t]++
+		if tool.Status {
+			e.lastSuccess[t] = now
+		} else {
+			e.failures[t]++
+		}
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	if err := e.WriteMetrics(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(b.Bytes())
+}
+
+// metric is a family of samples sharing a name.
+type metric struct {
+	name, kind, help string
+	samples          []sample
+}
+
+type sample struct {
+	labels [][2]string
+	value  float64
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format.
+func (e *Exporter) WriteMetrics(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	project := [2]string{"project", e.project}
+	metrics := []*metric{
+		{name: "caravan_project_status_info", kind: "gauge", help: "Status of the caravan project."},
+		{name: "caravan_tool_up", kind: "gauge", help: "Whether the tool is available (1) or not (0)."},
+		{name: "caravan_tool_info", kind: "gauge", help: "Version and health state of the tool."},
+		{name: "caravan_tool_check_duration_seconds", kind: "gauge", help: "Duration of the last health check of the tool."},
+		{name: "caravan_tool_last_success_timestamp_seconds", kind: "gauge", help: "Time of the last check finding the tool available."},
+		{name: "caravan_tool_checks_total", kind: "counter", help: "Number of health checks of the tool."},
+		{name: "caravan_tool_check_failures_total", kind: "counter", help: "Number of health checks finding the tool not available."},
+	}
+	status, up, info, duration, success, checks, failures := metrics[0], metrics[1], metrics[2], metrics[3], metrics[4], metrics[5], metrics[6]
+
+	if e.status != "" {
+		status.add(1, project, [2]string{"status", e.status})
+	}
+	for _, t := range e.targets {
+		tool, ok := e.tools[t]
+		if !ok {
+			continue
+		}
+		name := [2]string{"tool", t}
+		v := 0.0
+		if tool.Status {
+			v = 1
+		}
+		up.add(v, project, name)
+		version := tool.Version
+		if strings.HasPrefix(version, "error:") {
+			// the checkers report the failure to read the version in its place
+			version = ""
+		}
+		info.add(1, project, name, [2]string{"version", version}, [2]string{"state", string(tool.Health.State)})
+		duration.add(tool.Health.Latency.Seconds(), project, name)
+		if ts, ok := e.lastSuccess[t]; ok {
+			success.add(float64(ts.UnixNano())/1e9, project, name)
+		}
+		checks.add(float64(e.checks[t]), project, name)
+		failures.add(float64(e.failures[t]), project, name)
+	}
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *metric) add(v float64, labels ...[2]string) {
+	m.samples = append(m.samples, sample{labels: labels, value: v})
+}
+
+func (m *metric) write(w io.Writer) error {
+	if len(m.samples) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+		return err
+	}
+	sort.SliceStable(m.samples, func(i, j int) bool {
+		return labelString(m.samples[i].labels) < labelString(m.samples[j].labels)
+	})
+	for _, s := range m.samples {
+		if _, err := fmt.Fprintf(w, "%s{%s} %g\n", m.name, labelString(s.labels), s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelString(labels [][2]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, l := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, l[0], labelEscaper.Replace(l[1])))
+	}
+	return strings.Join(pairs, ",")
+}
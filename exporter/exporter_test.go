@@ -0,0 +1,54 @@
+package exporter_test
+
+import (
+	"bytes"
+	"caravan-cli/cli"
+	"caravan-cli/cli/checker"
+	"caravan-cli/exporter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	e := exporter.New("name")
+	targets := []string{cli.Vault, cli.Consul, cli.Nomad}
+	ok := cli.Tool{Status: true, Version: "1.13.2", Health: checker.HealthResult{State: checker.Healthy, Latency: 25 * time.Millisecond}}
+	sealed := cli.Tool{Version: "1.13.2", Health: checker.HealthResult{State: checker.Sealed}}
+	consul := cli.Tool{Version: `1.15"2`, Health: checker.HealthResult{State: checker.Unreachable}}
+	nomad := cli.Tool{Version: "error: /v1/agent/self returned 403: forbidden\n", Health: checker.HealthResult{State: checker.Unreachable}}
+
+	e.Update(cli.ApplicationDeployDone, targets, map[string]cli.Tool{cli.Vault: ok, cli.Consul: consul}, time.Unix(1685610000, 0))
+	e.Update(cli.ApplicationDeployDone, targets, map[string]cli.Tool{cli.Vault: sealed, cli.Consul: consul, cli.Nomad: nomad}, time.Unix(1685610010, 0))
+
+	var b bytes.Buffer
+	if err := e.WriteMetrics(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE caravan_tool_up gauge",
+		`caravan_project_status_info{project="name",status="ApplicationDeployDone"} 1`,
+		`caravan_tool_up{project="name",tool="vault"} 0`,
+		`caravan_tool_info{project="name",tool="consul",version="1.15\"2",state="unreachable"} 1`,
+		`caravan_tool_info{project="name",tool="vault",version="1.13.2",state="sealed"} 1`,
+		`caravan_tool_info{project="name",tool="nomad",version="",state="unreachable"} 1`,
+		`caravan_tool_last_success_timestamp_seconds{project="name",tool="vault"} 1.68561e+09`,
+		`caravan_tool_checks_total{project="name",tool="vault"} 2`,
+		`caravan_tool_check_failures_total{project="name",tool="vault"} 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("missing %s in:\n%s", want, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `caravan_tool_last_success_timestamp_seconds{project="name",tool="consul"}`) {
+		t.Errorf("last success of a tool never available:\n%s", b.String())
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != exporter.ContentType || rec.Body.String() != b.String() {
+		t.Errorf("unexpected response %d %s:\n%s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package git
 
 import (
 	"caravan-cli/cli"
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -10,7 +11,9 @@ import (
 	"github.com/rs/zerolog/log"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
 type Git struct {
@@ -25,7 +28,7 @@ func NewGit(org string, logLevel string) (g Git) {
 func (g Git) Clone(name, dest, branch string) (err error) {
 	log.Info().Msgf("cloning repo %s/%s to %s - branch: %s", g.org, name, dest, branch)
 	cloneOptions := &git.CloneOptions{
-		URL: "https://github.com/" + g.org + "/" + name,
+		URL: g.url(name),
 	}
 	if g.logLevel == cli.LogLevelDebug {
 		cloneOptions.Progress = os.Stdout
@@ -63,3 +66,32 @@ func (g Git) Clone(name, dest, branch string) (err error) {
 
 	return nil
 }
+
+// Reachable checks that the references of the repo can be listed from its remote.
+func (g Git) Reachable(ctx context.Context, name string) error {
+	r := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{g.url(name)},
+	})
+	if _, err := r.ListContext(ctx, &git.ListOptions{}); err != nil {
+		return fmt.Errorf("unable to reach repo %s: %w", g.url(name), err)
+	}
+	return nil
+}
+
+func (g Git) url(name string) string {
+	return "https://github.com/" + g.org + "/" + name
+}
+
+// Head returns the commit checked out in the repo at the given path.
+func Head(path string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("unable to open repo %s: %w", path, err)
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("unable to read head of repo %s: %w", path, err)
+	}
+	return ref.Hash().String(), nil
+}
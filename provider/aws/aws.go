@@ -4,6 +4,7 @@ package aws
 import (
 	"caravan-cli/cli"
 	"caravan-cli/provider"
+	"caravan-cli/terraform"
 	"context"
 	"fmt"
 	"net"
@@ -145,15 +146,49 @@ func (a AWS) CleanProvider(ctx context.Context) error {
 	return nil
 }
 
+func (a AWS) PullState(ctx context.Context) ([]byte, string, error) {
+	return a.ReadStateObject(ctx, a.Caravan.StateStoreName, provider.RemoteStateObject)
+}
+
+func (a AWS) PushState(ctx context.Context, data []byte, version string) (string, error) {
+	return a.WriteStateObject(ctx, a.Caravan.StateStoreName, provider.RemoteStateObject, data, version)
+}
+
 func (a AWS) Deploy(ctx context.Context, layer cli.DeployLayer) error {
-	switch layer {
-	case cli.Infrastructure:
-		return provider.GenericDeployInfra(ctx, a.Caravan, []string{"aws_lb.hashicorp_alb", "*"})
-	case cli.Platform:
-		return provider.GenericDeployPlatform(ctx, a.Caravan, []string{"*"})
-	case cli.ApplicationSupport:
-		return provider.GenericDeployApplicationSupport(ctx, a.Caravan, []string{"*"})
-	default:
-		return fmt.Errorf("unknown Deploy Layer")
+	if layer == cli.Infrastructure {
+		// the load balancer is created first as the other resources depend on its address
+		return a.DeployTargets(ctx, layer, []string{"aws_lb.hashicorp_alb", "*"})
+	}
+	return a.GenericProvider.Deploy(ctx, layer)
+}
+
+// StateLocks lists the terraform locks of the layers held in the DynamoDB lock table.
+func (a AWS) StateLocks(ctx context.Context) ([]provider.StateLock, error) {
+	items, err := a.ListLockItems(ctx, a.Caravan.LockName)
+	if err != nil {
+		return nil, err
 	}
+	locks := []provider.StateLock{}
+	for _, l := range cli.Layers {
+		info, ok := items[a.lockID(l)]
+		if !ok {
+			continue
+		}
+		li, err := terraform.ParseLockInfo([]byte(info))
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, provider.StateLock{Layer: l, LockInfo: li})
+	}
+	return locks, nil
+}
+
+// ReleaseStateLock deletes the lock item of the layer from the DynamoDB lock table.
+func (a AWS) ReleaseStateLock(ctx context.Context, lock provider.StateLock) error {
+	return a.DeleteLockItem(ctx, a.Caravan.LockName, a.lockID(lock.Layer))
+}
+
+// lockID returns the ID of the item terraform locks the state of the layer with.
+func (a AWS) lockID(l cli.DeployLayer) string {
+	return a.Caravan.StateStoreName + "/" + provider.StateKey(l)
 }
@@ -1,9 +1,13 @@
 package aws
 
 import (
+	"bytes"
+	"caravan-cli/cli"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 	"time"
 
@@ -12,6 +16,7 @@ import (
 	types2 "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 func (a AWS) CreateStateStore(ctx context.Context, name string) (err error) {
@@ -197,3 +202,92 @@ func (a AWS) DeleteLock(ctx context.Context, name string) (err error) {
 	}
 	return nil
 }
+
+// WriteStateObject writes an object of the given bucket provided that its ETag is still the given one,
+// or that it does not exist when the ETag is empty, and returns the new ETag.
+func (a AWS) WriteStateObject(ctx context.Context, bucket, key string, data []byte, etag string) (string, error) {
+	// the SDK release in use does not expose the conditional write headers, set them on the request
+	condition := smithyhttp.SetHeaderValue("If-None-Match", "*")
+	if etag != "" {
+		condition = smithyhttp.SetHeaderValue("If-Match", etag)
+	}
+	svc := s3.NewFromConfig(a.AWSConfig)
+	out, err := svc.PutObject(
+		ctx,
+		&s3.PutObjectInput{
+			Bucket:      aws2.String(bucket),
+			Key:         aws2.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws2.String("application/json"),
+		},
+		s3.WithAPIOptions(condition))
+	if err != nil {
+		var re interface{ HTTPStatusCode() int }
+		if errors.As(err, &re) && (re.HTTPStatusCode() == http.StatusPreconditionFailed || re.HTTPStatusCode() == http.StatusConflict) {
+			return "", cli.RemoteStateConflict{Err: fmt.Errorf("object %s of bucket %s changed: %w", key, bucket, err)}
+		}
+		return "", fmt.Errorf("error writing object %s to bucket %s: %w", key, bucket, err)
+	}
+	return aws2.ToString(out.ETag), nil
+}
+
+// ReadStateObject reads an object of the given bucket and its ETag.
+func (a AWS) ReadStateObject(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	var nsk *types.NoSuchKey
+
+	svc := s3.NewFromConfig(a.AWSConfig)
+	out, err := svc.GetObject(
+		ctx,
+		&s3.GetObjectInput{
+			Bucket: aws2.String(bucket),
+			Key:    aws2.String(key),
+		})
+	if err != nil {
+		if errors.As(err, &nsk) {
+			return nil, "", cli.RemoteStateNotFound{Err: err}
+		}
+		return nil, "", fmt.Errorf("error reading object %s from bucket %s: %w", key, bucket, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	return data, aws2.ToString(out.ETag), err
+}
+
+// ListLockItems returns the Info attribute of the terraform lock items of the given table, by LockID.
+// The digest items of the states, which carry no Info, are left out.
+func (a AWS) ListLockItems(ctx context.Context, name string) (map[string]string, error) {
+	svc := dynamodb.NewFromConfig(a.AWSConfig)
+	items := map[string]string{}
+	p := dynamodb.NewScanPaginator(svc, &dynamodb.ScanInput{TableName: aws2.String(name)})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan lock table %s: %w", name, err)
+		}
+		for _, item := range out.Items {
+			id, ok := item["LockID"].(*types2.AttributeValueMemberS)
+			if !ok {
+				continue
+			}
+			if info, ok := item["Info"].(*types2.AttributeValueMemberS); ok {
+				items[id.Value] = info.Value
+			}
+		}
+	}
+	return items, nil
+}
+
+// DeleteLockItem removes the lock item with the given LockID from the table.
+func (a AWS) DeleteLockItem(ctx context.Context, name, lockID string) error {
+	svc := dynamodb.NewFromConfig(a.AWSConfig)
+	_, err := svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws2.String(name),
+		Key: map[string]types2.AttributeValue{
+			"LockID": &types2.AttributeValueMemberS{Value: lockID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to delete lock %s from table %s: %w", lockID, name, err)
+	}
+	return nil
+}
@@ -4,10 +4,21 @@ package azure
 import (
 	"caravan-cli/cli"
 	"caravan-cli/provider"
+	"caravan-cli/terraform"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog/log"
 )
 
+// storageContainerName is the name of the container holding the terraform and caravan states.
+const storageContainerName = "tfstate"
+
 type Azure struct {
 	provider.GenericProvider
 	AzureHelper *Helper
@@ -16,13 +27,13 @@ type Azure struct {
 func New(ctx context.Context, c *cli.Config) (Azure, error) {
 	a := Azure{}
 	var err error
+	// the configuration is validated by init only, so that the projects created before the naming rules
+	// were enforced can still be inspected and cleaned
 	a.Caravan = c
-	if err = a.ValidateConfiguration(ctx); err != nil {
-		return a, err
-	}
 	if a.AzureHelper, err = NewHelper(a.Caravan.AzureUseCLI, a.Caravan.AzureSubscriptionID); err != nil {
 		return a, err
 	}
+	a.Env = armEnv(c.AzureClientID, c.AzureClientSecret, c.AzureSubscriptionID, c.AzureTenantID)
 	return a, nil
 }
 
@@ -74,9 +85,70 @@ func (a Azure) GetTemplates(ctx context.Context) ([]cli.Template, error) {
 	}, nil
 }
 
+var (
+	projectNameRegexp    = regexp.MustCompile("^[0-9a-z]{3,19}$")
+	storageAccountRegexp = regexp.MustCompile("^[0-9a-z]{3,24}$")
+	resourceGroupRegexp  = regexp.MustCompile(`^[-\w._()]{1,90}$`)
+	uuidRegexp           = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+)
+
+// ValidateConfiguration checks the configuration against the Azure naming rules without any cloud call,
+// reporting all the violations at once. The global uniqueness of the storage account name can only be
+// checked by InitProvider.
 func (a Azure) ValidateConfiguration(ctx context.Context) error {
-	//TODO: implement me
-	return nil
+	var err error
+	c := a.Caravan
+
+	// check project name, the storage account name derived from it must be a valid one as well
+	if !projectNameRegexp.MatchString(c.Name) {
+		err = multierror.Append(err, fmt.Errorf("project name not compliant: must be between 3 and 19 characters long, only lowercase alphanumerics are allowed for the storage account name %s to be valid: %s", storageAccountName(c.Name), c.Name))
+	}
+	if sa := c.AzureStorageAccount; sa != "" && !storageAccountRegexp.MatchString(sa) {
+		err = multierror.Append(err, fmt.Errorf("storage account name not compliant: must be between 3 and 24 characters long, only lowercase alphanumerics are allowed: %s", sa))
+	}
+
+	// check resource groups
+	if c.AzureResourceGroup == "" {
+		err = multierror.Append(err, fmt.Errorf("please provide a resource group"))
+	}
+	for _, rg := range []string{c.AzureResourceGroup, c.AzureDNSResourceGroup, c.AzureBakingResourceGroup} {
+		if rg == "" {
+			continue
+		}
+		if !resourceGroupRegexp.MatchString(rg) || strings.HasSuffix(rg, ".") {
+			err = multierror.Append(err, fmt.Errorf("resource group name not compliant: must be between 1 and 90 characters long, only alphanumerics, underscores, hyphens, periods and parentheses are allowed and cannot end with a period: %s", rg))
+		}
+	}
+
+	// check valid location
+	if c.Region == "" {
+		err = multierror.Append(err, fmt.Errorf("please provide a location"))
+	} else if !locations[c.Region] {
+		err = multierror.Append(err, fmt.Errorf("azure location %s not supported", c.Region))
+	}
+
+	// check subscription and tenant
+	ids := []struct {
+		name     string
+		value    string
+		required bool
+	}{
+		{name: "subscription ID", value: c.AzureSubscriptionID, required: true},
+		{name: "tenant ID", value: c.AzureTenantID, required: true},
+		{name: "baking subscription ID", value: c.AzureBakingSubscriptionID},
+	}
+	for _, id := range ids {
+		if id.value == "" {
+			if id.required {
+				err = multierror.Append(err, fmt.Errorf("please provide a %s", id.name))
+			}
+			continue
+		}
+		if !uuidRegexp.MatchString(id.value) {
+			err = multierror.Append(err, fmt.Errorf("%s not compliant: must be a UUID: %s", id.name, id.value))
+		}
+	}
+	return err
 }
 
 func (a Azure) InitProvider(ctx context.Context) error {
@@ -87,7 +159,7 @@ func (a Azure) InitProvider(ctx context.Context) error {
 	}
 
 	//TODO: create storage account (prefix)sa
-	saName := fmt.Sprintf("crv%ssa", a.Caravan.Name)
+	saName := storageAccountName(a.Caravan.Name)
 	err = a.AzureHelper.CreateStorageAccount(ctx, saName, a.Caravan.AzureResourceGroup, a.Caravan.Region)
 	if err != nil {
 		return err
@@ -95,7 +167,7 @@ func (a Azure) InitProvider(ctx context.Context) error {
 	a.Caravan.SetAzureStorageAccount(saName)
 
 	//TODO: create storage container tfstate
-	containerName := "tfstate"
+	containerName := storageContainerName
 	err = a.AzureHelper.CreateStorageContainer(ctx, a.Caravan.AzureResourceGroup, a.Caravan.AzureStorageAccount, containerName)
 	if err != nil {
 		return err
@@ -103,7 +175,7 @@ func (a Azure) InitProvider(ctx context.Context) error {
 	a.Caravan.SetAzureStorageContainerName(containerName)
 
 	//TODO: create service principal (prefix)-tf-sp Contributor on the RG + ParentRG
-	clientID, clientSecret, err := a.AzureHelper.CreateServicePrincipal(ctx, a.Caravan.AzureTenantID, fmt.Sprintf("%s-tf-sp", a.Caravan.Name))
+	clientID, clientSecret, err := a.AzureHelper.CreateServicePrincipal(ctx, a.Caravan.AzureTenantID, servicePrincipalName(a.Caravan.Name))
 	if err != nil {
 		return err
 	}
@@ -196,23 +268,135 @@ func (a Azure) InitProvider(ctx context.Context) error {
 	return nil
 }
 
+// Bake performs the terraform apply to the caravan-baking repo with the baking credentials, if any.
 func (a Azure) Bake(ctx context.Context) error {
-	panic("implement me")
+	g := a.GenericProvider
+	c := a.Caravan
+	if c.AzureBakingClientID != "" {
+		subscriptionID := c.AzureBakingSubscriptionID
+		if subscriptionID == "" {
+			subscriptionID = c.AzureSubscriptionID
+		}
+		g.Env = armEnv(c.AzureBakingClientID, c.AzureBakingClientSecret, subscriptionID, c.AzureTenantID)
+	}
+	return g.Bake(ctx)
+}
+
+func (a Azure) CleanProvider(ctx context.Context) error {
+	c := a.Caravan
+	log.Info().Msgf("removing terraform state store and service principal")
+
+	if c.AzureClientID != "" {
+		scopes := []string{fmt.Sprintf("/subscriptions/%s", c.AzureSubscriptionID)}
+		for _, rg := range []string{c.AzureResourceGroup, c.AzureDNSResourceGroup, c.AzureBakingResourceGroup} {
+			if rg != "" {
+				scopes = append(scopes, fmt.Sprintf("/subscriptions/%s/resourceGroups/%s", c.AzureSubscriptionID, rg))
+			}
+		}
+		for _, scope := range scopes {
+			if err := a.AzureHelper.DeleteRoleAssignments(ctx, c.AzureSubscriptionID, scope, c.AzureClientID); err != nil {
+				return fmt.Errorf("error deleting role assignments with scope %s: %w", scope, err)
+			}
+		}
+	}
+	if err := a.AzureHelper.DeleteServicePrincipal(ctx, c.AzureTenantID, servicePrincipalName(c.Name)); err != nil {
+		return fmt.Errorf("error deleting service principal: %w", err)
+	}
+
+	sa, container := a.stateStore()
+	if err := a.AzureHelper.DeleteStorageContainer(ctx, c.AzureResourceGroup, sa, container); err != nil {
+		return fmt.Errorf("error deleting storage container: %w", err)
+	}
+	if err := a.AzureHelper.DeleteStorageAccount(ctx, sa, c.AzureResourceGroup); err != nil {
+		return fmt.Errorf("error deleting storage account: %w", err)
+	}
+	return nil
 }
 
-func (a Azure) Deploy(ctx context.Context, layer cli.DeployLayer) error {
-	panic("implement me")
+func (a Azure) PullState(ctx context.Context) ([]byte, string, error) {
+	sa, container := a.stateStore()
+	return a.AzureHelper.ReadBlob(ctx, sa, container, provider.RemoteStateObject)
 }
 
-func (a Azure) Destroy(ctx context.Context, layer cli.DeployLayer) error {
-	panic("implement me")
+func (a Azure) PushState(ctx context.Context, data []byte, version string) (string, error) {
+	sa, container := a.stateStore()
+	return a.AzureHelper.WriteBlob(ctx, sa, container, provider.RemoteStateObject, data, version)
 }
 
-func (a Azure) CleanProvider(ctx context.Context) error {
-	//TODO: implement me
-	return nil
+// stateStore returns the storage account and container created by InitProvider.
+func (a Azure) stateStore() (string, string) {
+	sa, container := a.Caravan.AzureStorageAccount, a.Caravan.AzureStorageContainerName
+	if sa == "" {
+		sa = storageAccountName(a.Caravan.Name)
+	}
+	if container == "" {
+		container = storageContainerName
+	}
+	return sa, container
+}
+
+// servicePrincipalName derives the name of the service principal used by terraform from the project name.
+func servicePrincipalName(name string) string {
+	return fmt.Sprintf("%s-tf-sp", name)
+}
+
+// armEnv returns the environment used by the terraform azurerm provider and backend to authenticate.
+func armEnv(clientID, clientSecret, subscriptionID, tenantID string) map[string]string {
+	env := map[string]string{}
+	for k, v := range map[string]string{
+		"ARM_CLIENT_ID":       clientID,
+		"ARM_CLIENT_SECRET":   clientSecret,
+		"ARM_SUBSCRIPTION_ID": subscriptionID,
+		"ARM_TENANT_ID":       tenantID,
+	} {
+		if v != "" {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// storageAccountName derives the name of the storage account from the project name.
+func storageAccountName(name string) string {
+	return fmt.Sprintf("crv%ssa", name)
 }
 
-func (a Azure) Status(ctx context.Context) error {
-	panic("implement me")
+// lockMetadata is the blob metadata terraform keeps the lock info in, base64 encoded.
+const lockMetadata = "terraformlockid"
+
+// StateLocks lists the leased state blobs of the layers with the lock info terraform saved in their metadata.
+func (a Azure) StateLocks(ctx context.Context) ([]provider.StateLock, error) {
+	sa, container := a.stateStore()
+	locks := []provider.StateLock{}
+	for _, l := range cli.Layers {
+		lease, metadata, err := a.AzureHelper.BlobLease(ctx, sa, container, provider.StateKey(l))
+		if err != nil {
+			if errors.As(err, &cli.RemoteStateNotFound{}) {
+				continue
+			}
+			return nil, err
+		}
+		if lease != "leased" {
+			continue
+		}
+		li := terraform.LockInfo{ID: "unknown", Path: provider.StateKey(l)}
+		if b, err := base64.StdEncoding.DecodeString(metadata[lockMetadata]); err == nil && len(b) > 0 {
+			if li, err = terraform.ParseLockInfo(b); err != nil {
+				return nil, err
+			}
+		}
+		locks = append(locks, provider.StateLock{Layer: l, LockInfo: li})
+	}
+	return locks, nil
+}
+
+// ReleaseStateLock breaks the lease of the state blob of the layer and removes the lock info from its metadata.
+func (a Azure) ReleaseStateLock(ctx context.Context, lock provider.StateLock) error {
+	sa, container := a.stateStore()
+	_, metadata, err := a.AzureHelper.BlobLease(ctx, sa, container, provider.StateKey(lock.Layer))
+	if err != nil {
+		return err
+	}
+	delete(metadata, lockMetadata)
+	return a.AzureHelper.BreakBlobLease(ctx, sa, container, provider.StateKey(lock.Layer), metadata)
 }
@@ -1,11 +1,17 @@
 package azure
 
 import (
+	"bytes"
+	"caravan-cli/cli"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 
 	"github.com/rs/zerolog/log"
@@ -348,6 +354,92 @@ func (a Helper) CreateADPermission(ctx context.Context, tenantID, clientID, scop
 	return nil
 }
 
+// DeleteStorageContainer az storage container delete --name "$CONTAINER_NAME" --account-name "$STORAGE_ACCOUNT".
+func (a Helper) DeleteStorageContainer(ctx context.Context, resourceGroupName, storageAccountName, containerName string) error {
+	if err := a.checkStorageContainer(ctx, resourceGroupName, storageAccountName, containerName); err != nil {
+		log.Info().Msgf("storage account container [%s] already removed", containerName)
+		return nil
+	}
+
+	log.Info().Msgf("deleting storage account container [%s] in [%s]", containerName, storageAccountName)
+	_, err := a.AzureArmStorageBlobContainersClient.Delete(ctx, resourceGroupName, storageAccountName, containerName, nil)
+	return err
+}
+
+// DeleteStorageAccount az storage account delete --name "$STORAGE_ACCOUNT" --resource-group "$RESOURCE_GROUP".
+func (a Helper) DeleteStorageAccount(ctx context.Context, storageAccountName, resourceGroupName string) error {
+	if err := a.checkStorageAccount(ctx, storageAccountName, resourceGroupName); err != nil {
+		log.Info().Msgf("storage account [%s] already removed", storageAccountName)
+		return nil
+	}
+
+	log.Info().Msgf("deleting storage account [%s] in resource group [%s]", storageAccountName, resourceGroupName)
+	_, err := a.AzureArmStorageAccountsClient.Delete(ctx, resourceGroupName, storageAccountName, nil)
+	return err
+}
+
+// DeleteRoleAssignments az role assignment delete --scope "$SCOPE" --assignee "$CLIENT_ID".
+// Only the assignments made directly on the scope are removed, the inherited ones are left untouched.
+func (a Helper) DeleteRoleAssignments(ctx context.Context, subscriptionID, scope, principalID string) error {
+	c, err := armauthorization.NewRoleAssignmentsClient(subscriptionID, a.AzureTokenCredential, nil)
+	if err != nil {
+		return err
+	}
+
+	res := c.NewListForScopePager(scope, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr(fmt.Sprintf("principalId eq '%s'", principalID)),
+	})
+	for res.More() {
+		page, err := res.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, ra := range page.Value {
+			if ra.ID == nil || ra.Properties == nil || ra.Properties.Scope == nil || !strings.EqualFold(*ra.Properties.Scope, scope) {
+				continue
+			}
+			log.Info().Msgf("deleting role assignment [%s] of principal [%s] with scope [%s]", *ra.ID, principalID, scope)
+			if _, err := c.DeleteByID(ctx, *ra.ID, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteServicePrincipal az ad sp delete --id "$CLIENT_ID" && az ad app delete --id "$APP_ID".
+func (a Helper) DeleteServicePrincipal(ctx context.Context, tenantID, name string) error {
+	c := graphrbac.NewServicePrincipalsClient(tenantID)
+	c.Authorizer = a.AzureGraphAuthorizer
+	c2 := graphrbac.NewApplicationsClient(tenantID)
+	c2.Authorizer = a.AzureGraphAuthorizer
+
+	filterQuery := fmt.Sprintf("displayName eq '%s'", name)
+
+	sps, err := c.List(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+	for _, sp := range sps.Values() {
+		log.Info().Msgf("deleting ad service principal [%s] with object id [%s]", name, *sp.ObjectID)
+		if _, err := c.Delete(ctx, *sp.ObjectID); err != nil {
+			return err
+		}
+	}
+
+	apps, err := c2.List(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+	for _, app := range apps.Values() {
+		log.Info().Msgf("deleting ad application [%s] with object id [%s]", name, *app.ObjectID)
+		if _, err := c2.Delete(ctx, *app.ObjectID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func setupAuthorizationWithResource(useCLI bool, resource string) (autorest.Authorizer, error) {
 	if useCLI {
 		return auth.NewAuthorizerFromCLIWithResource(resource)
@@ -393,3 +485,134 @@ func setupAzTokenCredential(useCLI bool) (azcore.TokenCredential, error) {
 	}
 	return credential, nil
 }
+
+// WriteBlob uploads data to a block blob of the given storage account container provided that its ETag
+// is still the given one, or that it does not exist when the ETag is empty, and returns the new ETag.
+func (a Helper) WriteBlob(ctx context.Context, storageAccountName, containerName, blobName string, data []byte, etag string) (string, error) {
+	log.Debug().Msgf("writing blob [%s] to container [%s] in [%s]", blobName, containerName, storageAccountName)
+
+	headers := map[string]string{"x-ms-blob-type": "BlockBlob", "Content-Type": "application/json", "If-None-Match": "*"}
+	if etag != "" {
+		delete(headers, "If-None-Match")
+		headers["If-Match"] = etag
+	}
+	resp, err := a.blobCall(ctx, http.MethodPut, storageAccountName, containerName, blobName, "", headers, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return resp.Header.Get("ETag"), nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return "", cli.RemoteStateConflict{Err: fmt.Errorf("blob [%s] in container [%s] changed: %s", blobName, containerName, resp.Status)}
+	default:
+		b, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("unable to write blob [%s]: %s %s", blobName, resp.Status, b)
+	}
+}
+
+// ReadBlob downloads a blob from the given storage account container, together with its ETag.
+func (a Helper) ReadBlob(ctx context.Context, storageAccountName, containerName, blobName string) ([]byte, string, error) {
+	log.Debug().Msgf("reading blob [%s] from container [%s] in [%s]", blobName, containerName, storageAccountName)
+
+	resp, err := a.blobRequest(ctx, http.MethodGet, storageAccountName, containerName, blobName)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return b, resp.Header.Get("ETag"), nil
+	case http.StatusNotFound:
+		return nil, "", cli.RemoteStateNotFound{Err: fmt.Errorf("no blob [%s] in container [%s]", blobName, containerName)}
+	default:
+		return nil, "", fmt.Errorf("unable to read blob [%s]: %s %s", blobName, resp.Status, b)
+	}
+}
+
+// BlobLease returns the lease state of a blob and its metadata, keyed by lowercase name.
+func (a Helper) BlobLease(ctx context.Context, storageAccountName, containerName, blobName string) (string, map[string]string, error) {
+	resp, err := a.blobRequest(ctx, http.MethodHead, storageAccountName, containerName, blobName)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil, cli.RemoteStateNotFound{Err: fmt.Errorf("no blob [%s] in container [%s]", blobName, containerName)}
+	default:
+		return "", nil, fmt.Errorf("unable to read properties of blob [%s]: %s", blobName, resp.Status)
+	}
+	metadata := map[string]string{}
+	for k := range resp.Header {
+		if name := strings.ToLower(k); strings.HasPrefix(name, "x-ms-meta-") {
+			metadata[strings.TrimPrefix(name, "x-ms-meta-")] = resp.Header.Get(k)
+		}
+	}
+	return resp.Header.Get("x-ms-lease-state"), metadata, nil
+}
+
+// BreakBlobLease breaks immediately the lease of a blob and replaces its metadata.
+func (a Helper) BreakBlobLease(ctx context.Context, storageAccountName, containerName, blobName string, metadata map[string]string) error {
+	log.Debug().Msgf("breaking lease of blob [%s] in container [%s] in [%s]", blobName, containerName, storageAccountName)
+
+	headers := map[string]string{"x-ms-lease-action": "break", "x-ms-lease-break-period": "0"}
+	resp, err := a.blobCall(ctx, http.MethodPut, storageAccountName, containerName, blobName, "comp=lease", headers, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("unable to break lease of blob [%s]: %s", blobName, resp.Status)
+	}
+
+	headers = map[string]string{}
+	for k, v := range metadata {
+		headers["x-ms-meta-"+k] = v
+	}
+	resp, err = a.blobCall(ctx, http.MethodPut, storageAccountName, containerName, blobName, "comp=metadata", headers, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to set metadata of blob [%s]: %s", blobName, resp.Status)
+	}
+	return nil
+}
+
+func (a Helper) blobRequest(ctx context.Context, method, storageAccountName, containerName, blobName string) (*http.Response, error) {
+	return a.blobCall(ctx, method, storageAccountName, containerName, blobName, "", map[string]string{}, nil)
+}
+
+func (a Helper) blobCall(ctx context.Context, method, storageAccountName, containerName, blobName, query string, headers map[string]string, data []byte) (*http.Response, error) {
+	token, err := a.AzureTokenCredential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://storage.azure.com/.default"}})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get storage token: %w", err)
+	}
+	u := fmt.Sprintf("https://%s.blob.%s/%s/%s", storageAccountName, azure.PublicCloud.StorageEndpointSuffix, containerName, blobName)
+	if query != "" {
+		u += "?" + query
+	}
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	req.Header.Set("x-ms-version", "2021-08-06")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return http.DefaultClient.Do(req)
+}
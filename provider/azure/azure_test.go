@@ -5,32 +5,64 @@ import (
 	"caravan-cli/provider"
 	"caravan-cli/provider/azure"
 	"context"
+	"errors"
 	"os"
 	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	subscriptionID = "00000000-0000-0000-0000-000000000001"
+	tenantID       = "00000000-0000-0000-0000-000000000002"
 )
 
 func TestValidate(t *testing.T) {
 	ctx := context.Background()
 	type test struct {
-		name  string
-		error bool
-		desc  string
+		name   string
+		region string
+		rg     string
+		tenant string
+		errors int
+		desc   string
 	}
 
 	tests := []test{
-		{name: "test-me", error: false, desc: "ok"},
+		{name: "testme", region: "westeurope", rg: "caravan-rg", tenant: tenantID, errors: 0, desc: "ok"},
+		{name: "test-me", region: "westeurope", rg: "caravan-rg", tenant: tenantID, errors: 1, desc: "hyphen in name"},
+		{name: "TestMe", region: "westeurope", rg: "caravan-rg", tenant: tenantID, errors: 1, desc: "uppercase name"},
+		{name: "averyveryverylongname", region: "westeurope", rg: "caravan-rg", tenant: tenantID, errors: 1, desc: "storage account too long"},
+		{name: "testme", region: "westeurope", rg: "caravan.", tenant: tenantID, errors: 1, desc: "resource group ending with period"},
+		{name: "testme", region: "", rg: "caravan-rg", tenant: tenantID, errors: 1, desc: "missing location"},
+		{name: "testme", region: "europe-west6", rg: "caravan-rg", tenant: tenantID, errors: 1, desc: "unknown location"},
+		{name: "testme", region: "westeurope", rg: "caravan-rg", tenant: "dummy", errors: 1, desc: "tenant not a UUID"},
+		{name: "te", region: "mars", rg: "", tenant: "", errors: 4, desc: "aggregated errors"},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.desc, func(t *testing.T) {
-			c, err := cli.NewConfigFromScratch(tc.name, provider.Azure, "westeurope")
+			c, err := cli.NewConfigFromScratch(tc.name, provider.Azure, tc.region)
 			if err != nil {
 				t.Fatalf("unable to create config: %s\n", err)
 			}
+			c.SetAzureResourceGroup(tc.rg)
+			c.SetAzureTenantID(tc.tenant)
+			c.SetAzureSubscriptionID(subscriptionID)
 			withAzureEnvVariables(func() {
-				_, err = azure.New(ctx, c)
-				if err == nil && tc.error || err != nil && !tc.error {
-					t.Errorf("something wen wrong: want %t but got %s", tc.error, err)
+				a, err := azure.New(ctx, c)
+				if err != nil {
+					t.Fatalf("unable to create provider: %s", err)
+				}
+				err = a.ValidateConfiguration(ctx)
+				var merr *multierror.Error
+				switch {
+				case tc.errors == 0 && err != nil:
+					t.Errorf("something went wrong: want no error but got %s", err)
+				case tc.errors > 0 && !errors.As(err, &merr):
+					t.Errorf("something went wrong: want %d errors but got %v", tc.errors, err)
+				case tc.errors > 0 && len(merr.Errors) != tc.errors:
+					t.Errorf("something went wrong: want %d errors but got %s", tc.errors, err)
 				}
 			})
 		})
@@ -50,3 +82,37 @@ func withAzureEnvVariables(f func()) {
 	}
 	f()
 }
+
+func TestARMEnv(t *testing.T) {
+	ctx := context.Background()
+	c, err := cli.NewConfigFromScratch("testme", provider.Azure, "westeurope")
+	if err != nil {
+		t.Fatalf("unable to create config: %s\n", err)
+	}
+	c.SetAzureResourceGroup("caravan-rg")
+	c.SetAzureClientID("client")
+	c.SetAzureClientSecret("secret")
+	c.SetAzureSubscriptionID(subscriptionID)
+	c.SetAzureTenantID(tenantID)
+
+	withAzureEnvVariables(func() {
+		a, err := azure.New(ctx, c)
+		if err != nil {
+			t.Fatalf("unable to create provider: %s", err)
+		}
+		want := map[string]string{
+			"ARM_CLIENT_ID":       "client",
+			"ARM_CLIENT_SECRET":   "secret",
+			"ARM_SUBSCRIPTION_ID": subscriptionID,
+			"ARM_TENANT_ID":       tenantID,
+		}
+		if len(a.Env) != len(want) {
+			t.Errorf("got env %v but wanted %v", a.Env, want)
+		}
+		for k, v := range want {
+			if a.Env[k] != v {
+				t.Errorf("got %s=%q but wanted %q", k, a.Env[k], v)
+			}
+		}
+	})
+}
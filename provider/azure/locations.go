@@ -0,0 +1,53 @@
+package azure
+
+// locations are the Azure public cloud locations, as listed by az account list-locations.
+var locations = map[string]bool{
+	"australiacentral":   true,
+	"australiacentral2":  true,
+	"australiaeast":      true,
+	"australiasoutheast": true,
+	"brazilsouth":        true,
+	"brazilsoutheast":    true,
+	"canadacentral":      true,
+	"canadaeast":         true,
+	"centralindia":       true,
+	"centralus":          true,
+	"eastasia":           true,
+	"eastus":             true,
+	"eastus2":            true,
+	"francecentral":      true,
+	"francesouth":        true,
+	"germanynorth":       true,
+	"germanywestcentral": true,
+	"italynorth":         true,
+	"japaneast":          true,
+	"japanwest":          true,
+	"jioindiacentral":    true,
+	"jioindiawest":       true,
+	"koreacentral":       true,
+	"koreasouth":         true,
+	"northcentralus":     true,
+	"northeurope":        true,
+	"norwayeast":         true,
+	"norwaywest":         true,
+	"polandcentral":      true,
+	"qatarcentral":       true,
+	"southafricanorth":   true,
+	"southafricawest":    true,
+	"southcentralus":     true,
+	"southeastasia":      true,
+	"southindia":         true,
+	"swedencentral":      true,
+	"switzerlandnorth":   true,
+	"switzerlandwest":    true,
+	"uaecentral":         true,
+	"uaenorth":           true,
+	"uksouth":            true,
+	"ukwest":             true,
+	"westcentralus":      true,
+	"westeurope":         true,
+	"westindia":          true,
+	"westus":             true,
+	"westus2":            true,
+	"westus3":            true,
+}
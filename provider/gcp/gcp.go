@@ -4,12 +4,15 @@ package gcp
 import (
 	"caravan-cli/cli"
 	"caravan-cli/provider"
+	"caravan-cli/terraform"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog/log"
@@ -200,3 +203,56 @@ func (g GCP) CleanProvider(ctx context.Context) error {
 	}
 	return nil
 }
+
+func (g GCP) PullState(ctx context.Context) ([]byte, string, error) {
+	data, gen, err := g.ReadStateObject(ctx, g.Caravan.StateStoreName, provider.RemoteStateObject)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, strconv.FormatInt(gen, 10), nil
+}
+
+func (g GCP) PushState(ctx context.Context, data []byte, version string) (string, error) {
+	var gen int64
+	if version != "" {
+		var err error
+		if gen, err = strconv.ParseInt(version, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid generation of the remote state: %w", err)
+		}
+	}
+	gen, err := g.WriteStateObject(ctx, g.Caravan.StateStoreName, provider.RemoteStateObject, data, gen)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(gen, 10), nil
+}
+
+// StateLocks lists the terraform lock files of the layers held in the state bucket.
+func (g GCP) StateLocks(ctx context.Context) ([]provider.StateLock, error) {
+	locks := []provider.StateLock{}
+	for _, l := range cli.Layers {
+		b, err := g.ReadStateStore(ctx, g.Caravan.StateStoreName, lockObject(l))
+		if err != nil {
+			if errors.As(err, &cli.RemoteStateNotFound{}) {
+				continue
+			}
+			return nil, err
+		}
+		li, err := terraform.ParseLockInfo(b)
+		if err != nil {
+			return nil, err
+		}
+		locks = append(locks, provider.StateLock{Layer: l, LockInfo: li})
+	}
+	return locks, nil
+}
+
+// ReleaseStateLock deletes the lock file of the layer from the state bucket.
+func (g GCP) ReleaseStateLock(ctx context.Context, lock provider.StateLock) error {
+	return g.DeleteStateObject(ctx, g.Caravan.StateStoreName, lockObject(lock.Layer))
+}
+
+// lockObject returns the name of the file terraform locks the state of the layer with.
+func lockObject(l cli.DeployLayer) string {
+	return provider.StatePrefixes[l] + "/default.tflock"
+}
@@ -1,9 +1,12 @@
 package gcp
 
 import (
+	"caravan-cli/cli"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"cloud.google.com/go/storage"
 	"google.golang.org/api/cloudbilling/v1"
 	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iam/v1"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/serviceusage/v1"
@@ -70,26 +74,90 @@ func (g GCP) DeleteStateStore(ctx context.Context, name string) error {
 }
 
 func (g GCP) WriteStateStore(ctx context.Context, bucket, object, data string) error {
+	_, err := g.writeObject(ctx, bucket, object, []byte(data), nil)
+	return err
+}
+
+// WriteStateObject writes an object of the given bucket provided that its generation is still the given
+// one, or that it does not exist when the generation is 0, and returns the new generation.
+func (g GCP) WriteStateObject(ctx context.Context, bucket, object string, data []byte, generation int64) (int64, error) {
+	conds := storage.Conditions{DoesNotExist: true}
+	if generation != 0 {
+		conds = storage.Conditions{GenerationMatch: generation}
+	}
+	gen, err := g.writeObject(ctx, bucket, object, data, &conds)
+	var ae *googleapi.Error
+	if errors.As(err, &ae) && ae.Code == http.StatusPreconditionFailed {
+		return 0, cli.RemoteStateConflict{Err: fmt.Errorf("object %s of bucket %s changed: %w", object, bucket, err)}
+	}
+	return gen, err
+}
+
+func (g GCP) writeObject(ctx context.Context, bucket, object string, data []byte, conds *storage.Conditions) (int64, error) {
 	log.Info().Msgf("getting writer on bucket %s on project: %s", bucket, g.Caravan.Name)
 
 	client, err := storage.NewClient(ctx)
 	if err != nil {
-		return fmt.Errorf("storage.NewClient: %w", err)
+		return 0, fmt.Errorf("storage.NewClient: %w", err)
 	}
 	defer client.Close()
 
-	wc := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	o := client.Bucket(bucket).Object(object)
+	if conds != nil {
+		o = o.If(*conds)
+	}
+	wc := o.NewWriter(ctx)
 	wc.ContentType = "text/plain"
-	wc.ACL = []storage.ACLRule{{Entity: "user-andrea.simonini@bitrock.it", Role: storage.RoleOwner}}
-	if _, err := wc.Write([]byte(data)); err != nil {
-		if err != nil {
-			return err
-		}
+	if g.Caravan.GCPUserEmail != "" {
+		wc.ACL = []storage.ACLRule{{Entity: storage.ACLEntity("user-" + g.Caravan.GCPUserEmail), Role: storage.RoleOwner}}
+	}
+	if _, err := wc.Write(data); err != nil {
+		return 0, err
 	}
 	if err := wc.Close(); err != nil {
-		return err
+		return 0, err
+	}
+	return wc.Attrs().Generation, nil
+}
+
+func (g GCP) ReadStateStore(ctx context.Context, bucket, object string) ([]byte, error) {
+	data, _, err := g.ReadStateObject(ctx, bucket, object)
+	return data, err
+}
+
+// ReadStateObject reads an object of the given bucket and its generation.
+func (g GCP) ReadStateObject(ctx context.Context, bucket, object string) ([]byte, int64, error) {
+	log.Debug().Msgf("getting reader on bucket %s on project: %s", bucket, g.Caravan.Name)
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("storage.NewClient: %w", err)
 	}
+	defer client.Close()
 
+	rc, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, 0, cli.RemoteStateNotFound{Err: err}
+		}
+		return nil, 0, fmt.Errorf("error reading object %s from bucket %s: %w", object, bucket, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	return data, rc.Attrs.Generation, err
+}
+
+// DeleteStateObject removes an object from the given bucket.
+func (g GCP) DeleteStateObject(ctx context.Context, bucket, object string) error {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("storage.NewClient: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Bucket(bucket).Object(object).Delete(ctx); err != nil {
+		return fmt.Errorf("error deleting object %s from bucket %s: %w", object, bucket, err)
+	}
 	return nil
 }
 
@@ -4,7 +4,9 @@ import (
 	"caravan-cli/cli"
 	"caravan-cli/terraform"
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -14,16 +16,26 @@ import (
 // GenericProvider is the generic implementation of the Provider interface and holds the Caravan config.
 type GenericProvider struct {
 	Caravan *cli.Config
+	// Env holds the provider specific environment, e.g. the credentials, passed to each terraform run.
+	Env map[string]string
+	// Executor runs the terraform commands, the terraform binary is used when nil.
+	Executor terraform.Executor
+}
+
+// applyTimeouts are the timeouts of the terraform apply of each layer.
+var applyTimeouts = map[cli.DeployLayer]time.Duration{
+	cli.Infrastructure:     1200 * time.Second,
+	cli.Platform:           600 * time.Second,
+	cli.ApplicationSupport: 600 * time.Second,
 }
 
 // Bake performs the terraform apply to the caravan-baking repo.
 func (g GenericProvider) Bake(ctx context.Context) error {
-	t := terraform.New(g.Caravan.LogLevel)
+	t := g.executor()
 	if err := t.Init(ctx, g.Caravan.WorkdirBaking); err != nil {
 		return err
 	}
-	env := map[string]string{}
-	if err := t.ApplyVarFile(ctx, filepath.Base(g.Caravan.WorkdirBakingVars), 1800*time.Second, env, "*"); err != nil {
+	if err := t.ApplyVarFile(ctx, filepath.Base(g.Caravan.WorkdirBakingVars), 1800*time.Second, g.env(), "*"); err != nil {
 		return err
 	}
 	return nil
@@ -31,142 +43,139 @@ func (g GenericProvider) Bake(ctx context.Context) error {
 
 // Depoly executes the corresponding terraform apply for the given layers/caravan repo.
 func (g GenericProvider) Deploy(ctx context.Context, layer cli.DeployLayer) error {
-	switch layer {
-	case cli.Infrastructure:
-		return GenericDeployInfra(ctx, g.Caravan, []string{"*"})
-	case cli.Platform:
-		return GenericDeployPlatform(ctx, g.Caravan, []string{"*"})
-	case cli.ApplicationSupport:
-		return GenericDeployApplicationSupport(ctx, g.Caravan, []string{"*"})
-	default:
-		return fmt.Errorf("unknown Deploy Layer")
-	}
+	return g.DeployTargets(ctx, layer, []string{"*"})
 }
 
-func GenericDeployInfra(ctx context.Context, c *cli.Config, targets []string) error {
-	// Infra
-	log.Info().Msgf("deploying infra")
-	tf := terraform.New(c.LogLevel)
-	if err := tf.Init(ctx, c.WorkdirInfra); err != nil {
+// DeployTargets applies the given layer one target at a time, "*" standing for the whole configuration.
+func (g GenericProvider) DeployTargets(ctx context.Context, layer cli.DeployLayer, targets []string) error {
+	c := g.Caravan
+	wd := c.LayerWorkdir(layer)
+	if wd == "" {
+		return fmt.Errorf("unknown Deploy Layer")
+	}
+	log.Info().Msgf("deploying %s", layer)
+	tf := g.executor()
+	if err := tf.Init(ctx, wd); err != nil {
 		return err
 	}
-	env := map[string]string{}
+	env := g.layerEnv(layer)
+	if c.UseSavedPlan {
+		if _, err := os.Stat(c.LayerPlan(layer)); !errors.Is(err, os.ErrNotExist) {
+			return applySavedPlan(ctx, tf, c, layer, applyTimeouts[layer], env)
+		}
+		// the layers above the ones deployed cannot be planned yet
+		log.Warn().Msgf("no saved plan found for %s layer: applying its current configuration", layer)
+	}
 	for _, target := range targets {
-		if err := tf.ApplyVarFile(ctx, filepath.Base(c.WorkdirInfraVars), 1200*time.Second, env, target); err != nil {
+		if err := tf.ApplyVarFile(ctx, filepath.Base(c.LayerVars(layer)), applyTimeouts[layer], env, target); err != nil {
 			return fmt.Errorf("error doing terraform apply: %w", err)
 		}
 	}
 	return nil
 }
 
-func GenericDeployPlatform(ctx context.Context, c *cli.Config, targets []string) error {
-	// Platform
-	log.Info().Msgf("deploying platform")
-	tf := terraform.New(c.LogLevel)
-	if err := tf.Init(ctx, c.WorkdirPlatform); err != nil {
-		return err
-	}
-	env := map[string]string{
-		"VAULT_TOKEN": c.VaultRootToken,
-		"NOMAD_TOKEN": c.NomadToken,
+// applySavedPlan applies the plan previously saved for the layer and removes it once applied.
+func applySavedPlan(ctx context.Context, tf terraform.Executor, c *cli.Config, layer cli.DeployLayer, timeout time.Duration, env map[string]string) error {
+	plan := c.LayerPlan(layer)
+	if err := tf.ApplyPlan(ctx, filepath.Base(plan), timeout, env); err != nil {
+		return fmt.Errorf("error applying saved plan %s: %w", plan, err)
 	}
-	for _, target := range targets {
-		if err := tf.ApplyVarFile(ctx, filepath.Base(c.WorkdirPlatformVars), 600*time.Second, env, target); err != nil {
-			return fmt.Errorf("error doing terraform apply: %w", err)
-		}
+	if err := os.Remove(plan); err != nil {
+		log.Warn().Msgf("unable to remove applied plan %s: %s", plan, err)
 	}
 	return nil
 }
 
-func GenericDeployApplicationSupport(ctx context.Context, c *cli.Config, targets []string) error {
-	// Application support
-	log.Info().Msgf("deploying application")
-	tf := terraform.New(c.LogLevel)
-	if err := tf.Init(ctx, c.WorkdirApplication); err != nil {
-		return err
+// Plan saves the terraform plan for the given layer and returns a summary of the planned changes.
+func (g GenericProvider) Plan(ctx context.Context, layer cli.DeployLayer) (s terraform.PlanSummary, err error) {
+	c := g.Caravan
+	wd := c.LayerWorkdir(layer)
+	if wd == "" {
+		return s, fmt.Errorf("cannot plan unknown deploy layer: %d", layer)
+	}
+	log.Info().Msgf("planning %s", layer)
+	tf := g.executor()
+	if err := tf.Init(ctx, wd); err != nil {
+		return s, err
+	}
+	s, err = tf.Plan(ctx, filepath.Base(c.LayerVars(layer)), filepath.Base(c.LayerPlan(layer)), g.layerEnv(layer))
+	if err != nil {
+		return s, fmt.Errorf("error doing terraform plan: %w", err)
 	}
-	env := map[string]string{
-		"VAULT_TOKEN": c.VaultRootToken,
-		"NOMAD_TOKEN": c.NomadToken,
+	return s, nil
+}
+
+// Outputs reads the terraform outputs of the given layer.
+func (g GenericProvider) Outputs(ctx context.Context, layer cli.DeployLayer) (map[string]terraform.OutputValue, error) {
+	wd := g.Caravan.LayerWorkdir(layer)
+	if wd == "" {
+		return nil, fmt.Errorf("cannot read outputs of unknown deploy layer: %d", layer)
 	}
-	for _, target := range targets {
-		if err := tf.ApplyVarFile(ctx, filepath.Base(c.WorkdirApplicationVars), 600*time.Second, env, target); err != nil {
-			return fmt.Errorf("error doing terraform apply: %w", err)
-		}
+	tf := g.executor()
+	if err := tf.Init(ctx, wd); err != nil {
+		return nil, err
 	}
-	return nil
+	outputs, err := tf.Output(ctx, g.layerEnv(layer))
+	if err != nil {
+		return nil, fmt.Errorf("error reading terraform outputs: %w", err)
+	}
+	return outputs, nil
 }
 
-func (g GenericProvider) Destroy(ctx context.Context, layer cli.DeployLayer) error {
-	switch layer {
-	case cli.Infrastructure:
-		return g.cleanInfra(ctx)
-	case cli.Platform:
-		return g.cleanPlatform(ctx)
-	case cli.ApplicationSupport:
-		return g.cleanApplication(ctx)
-	default:
+// Destroy executes the terraform destroy of the given layer. Errors are ignored when forcing the clean.
+func (g GenericProvider) Destroy(ctx context.Context, layer cli.DeployLayer) (err error) {
+	wd := g.Caravan.LayerWorkdir(layer)
+	if wd == "" {
 		return fmt.Errorf("cannot destroy unknown deploy layer: %d", layer)
 	}
-}
-
-func (g GenericProvider) cleanInfra(ctx context.Context) (err error) {
-	log.Info().Msgf("removing terraform infrastructure")
-	tf := terraform.New(g.Caravan.LogLevel)
-	err = tf.Init(ctx, g.Caravan.WorkdirInfra)
+	log.Info().Msgf("removing terraform %s", layer)
+	tf := g.executor()
+	err = tf.Init(ctx, wd)
 	if err != nil {
 		return err
 	}
-	env := map[string]string{}
-	if err := tf.Destroy(ctx, filepath.Base(g.Caravan.WorkdirInfraVars), env); err != nil {
+	if err := tf.Destroy(ctx, filepath.Base(g.Caravan.LayerVars(layer)), g.layerEnv(layer)); err != nil {
 		log.Error().Msgf("error during destroy of cloud resources: %s", err)
-		if !g.Caravan.Force {
+		if !g.Caravan.Force || ctx.Err() != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (g GenericProvider) cleanPlatform(ctx context.Context) (err error) {
-	log.Info().Msgf("removing terraform platform")
-	tf := terraform.New(g.Caravan.LogLevel)
-	err = tf.Init(ctx, g.Caravan.WorkdirPlatform)
-	if err != nil {
-		return err
-	}
-	env := map[string]string{
-		"VAULT_TOKEN": g.Caravan.VaultRootToken,
-		"NOMAD_TOKEN": g.Caravan.NomadToken,
-	}
-	if err := tf.Destroy(ctx, filepath.Base(g.Caravan.WorkdirPlatformVars), env); err != nil {
-		log.Error().Msgf("error during destroy of cloud resources: %s", err)
-		if !g.Caravan.Force {
-			return err
-		}
+// Status prints the caravan report, checking the tools once the infrastructure is deployed.
+func (g GenericProvider) Status(ctx context.Context) error {
+	r := cli.NewReport(g.Caravan)
+	if g.Caravan.Status >= cli.InfraDeployDone {
+		r.CheckStatus(ctx)
 	}
+	r.PrintReport()
 	return nil
 }
 
-func (g GenericProvider) cleanApplication(ctx context.Context) (err error) {
-	log.Info().Msgf("removing terraform application")
-	tf := terraform.New(g.Caravan.LogLevel)
-	err = tf.Init(ctx, g.Caravan.WorkdirApplication)
-	if err != nil {
-		return err
-	}
-	env := map[string]string{
-		"VAULT_TOKEN": g.Caravan.VaultRootToken,
-		"NOMAD_TOKEN": g.Caravan.NomadToken,
+func (g GenericProvider) executor() terraform.Executor {
+	if g.Executor != nil {
+		return g.Executor
 	}
-	if err := tf.Destroy(ctx, filepath.Base(g.Caravan.WorkdirApplicationVars), env); err != nil {
-		log.Error().Msgf("error during destroy of cloud resources: %s", err)
-		if !g.Caravan.Force {
-			return err
-		}
+	return terraform.New(g.Caravan.LogLevel, terraform.WithBinary(g.Caravan.TerraformBinary))
+}
+
+// env returns a copy of the provider environment.
+func (g GenericProvider) env() map[string]string {
+	env := map[string]string{}
+	for k, v := range g.Env {
+		env[k] = v
 	}
-	return nil
+	return env
 }
 
-func (g GenericProvider) Status(ctx context.Context) error {
-	panic("implement me")
+// layerEnv returns the environment of the terraform runs of the given layer: the layers above
+// the infrastructure also need the Vault and Nomad tokens.
+func (g GenericProvider) layerEnv(layer cli.DeployLayer) map[string]string {
+	env := g.env()
+	if layer != cli.Infrastructure {
+		env["VAULT_TOKEN"] = g.Caravan.VaultRootToken
+		env["NOMAD_TOKEN"] = g.Caravan.NomadToken
+	}
+	return env
 }
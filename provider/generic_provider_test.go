@@ -0,0 +1,135 @@
+package provider_test
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/provider"
+	"caravan-cli/terraform"
+	"caravan-cli/terraform/terraformtest"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newGenericProvider(t *testing.T) (provider.GenericProvider, *terraformtest.Fake) {
+	t.Helper()
+	c, err := cli.NewConfigFromScratch("name", provider.AWS, "eu-south-1")
+	if err != nil {
+		t.Fatalf("unable to create config: %s", err)
+	}
+	c.VaultRootToken = "vault-token"
+	c.NomadToken = "nomad-token"
+	f := &terraformtest.Fake{}
+	return provider.GenericProvider{Caravan: c, Env: map[string]string{"CLOUD": "creds"}, Executor: f}, f
+}
+
+func TestGenericDeploy(t *testing.T) {
+	ctx := context.Background()
+	g, f := newGenericProvider(t)
+	c := g.Caravan
+
+	if err := g.DeployTargets(ctx, cli.Infrastructure, []string{"aws_lb.hashicorp_alb", "*"}); err != nil {
+		t.Fatalf("error deploying infra: %s", err)
+	}
+	if err := g.Deploy(ctx, cli.Platform); err != nil {
+		t.Fatalf("error deploying platform: %s", err)
+	}
+	if err := g.Deploy(ctx, cli.ApplicationSupport); err != nil {
+		t.Fatalf("error deploying application: %s", err)
+	}
+
+	infraEnv := map[string]string{"CLOUD": "creds"}
+	env := map[string]string{"CLOUD": "creds", "VAULT_TOKEN": "vault-token", "NOMAD_TOKEN": "nomad-token"}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirInfra, VarFile: "name-infra.tfvars", Target: "aws_lb.hashicorp_alb", Env: infraEnv},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirInfra, VarFile: "name-infra.tfvars", Target: "*", Env: infraEnv},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Target: "*", Env: env},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirApplication},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirApplication, VarFile: "name-aws-cli.tfvars", Target: "*", Env: env},
+	)
+	if g.Env["VAULT_TOKEN"] != "" {
+		t.Errorf("provider environment modified by the platform deploy")
+	}
+}
+
+func TestGenericBake(t *testing.T) {
+	g, f := newGenericProvider(t)
+	if err := g.Bake(context.Background()); err != nil {
+		t.Fatalf("error baking: %s", err)
+	}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: g.Caravan.WorkdirBaking},
+		terraformtest.Call{Command: "apply", Workdir: g.Caravan.WorkdirBaking, VarFile: "aws-baking.tfvars", Target: "*", Env: map[string]string{"CLOUD": "creds"}},
+	)
+}
+
+func TestGenericSavedPlan(t *testing.T) {
+	ctx := context.Background()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	g, f := newGenericProvider(t)
+	c := g.Caravan
+	f.Summary = terraform.PlanSummary{Add: 3}
+
+	s, err := g.Plan(ctx, cli.Platform)
+	if err != nil || s != f.Summary {
+		t.Fatalf("got %v, %v but wanted %v", s, err, f.Summary)
+	}
+
+	// a layer without a saved plan is applied as usual
+	c.UseSavedPlan = true
+	if err := g.Deploy(ctx, cli.Platform); err != nil {
+		t.Fatalf("error applying layer without saved plan: %s", err)
+	}
+
+	plan := c.LayerPlan(cli.Platform)
+	if err := os.MkdirAll(filepath.Dir(plan), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(plan, []byte("plan"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Deploy(ctx, cli.Platform); err != nil {
+		t.Fatalf("error applying saved plan: %s", err)
+	}
+	if _, err := os.Stat(plan); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("applied plan %s not removed", plan)
+	}
+
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "plan", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Plan: "name-platform.tfplan"},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirPlatform, VarFile: "name-aws-cli.tfvars", Target: "*"},
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirPlatform},
+		terraformtest.Call{Command: "apply", Workdir: c.WorkdirPlatform, Plan: "name-platform.tfplan"},
+	)
+}
+
+func TestGenericDestroy(t *testing.T) {
+	ctx := context.Background()
+	g, f := newGenericProvider(t)
+	c := g.Caravan
+	f.Errors = map[string]error{"destroy": errors.New("boom")}
+
+	if err := g.Destroy(ctx, cli.Infrastructure); err == nil {
+		t.Errorf("destroy error not reported")
+	}
+	c.Force = true
+	if err := g.Destroy(ctx, cli.Infrastructure); err != nil {
+		t.Errorf("destroy error reported when forcing: %s", err)
+	}
+
+	call := terraformtest.Call{Command: "destroy", Workdir: c.WorkdirInfra, VarFile: "name-infra.tfvars", Env: map[string]string{"CLOUD": "creds"}}
+	f.AssertCalls(t,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra}, call,
+		terraformtest.Call{Command: "init", Workdir: c.WorkdirInfra}, call,
+	)
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"caravan-cli/cli"
+	"caravan-cli/terraform"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StatePrefixes are the prefixes of the terraform state of each layer in the state store.
+var StatePrefixes = map[cli.DeployLayer]string{
+	cli.Infrastructure:     "infraboot/terraform/state",
+	cli.Platform:           "platform/terraform/state",
+	cli.ApplicationSupport: "appsupport/terraform/state",
+}
+
+// StateKey returns the key of the terraform state of the layer in the state store.
+func StateKey(layer cli.DeployLayer) string {
+	return StatePrefixes[layer] + "/terraform.tfstate"
+}
+
+// LayerOfStateKey returns the layer whose terraform state has the given key or path.
+func LayerOfStateKey(key string) (cli.DeployLayer, bool) {
+	for _, l := range cli.Layers {
+		if strings.Contains(key, StatePrefixes[l]) {
+			return l, true
+		}
+	}
+	return cli.Infrastructure, false
+}
+
+// StateLock is a lock held on the terraform state of a layer.
+type StateLock struct {
+	Layer cli.DeployLayer
+	terraform.LockInfo
+}
+
+// ErrStateLocksNotSupported is returned by the providers not able to list the terraform state locks.
+var ErrStateLocksNotSupported = errors.New("listing the terraform state locks is not supported by the provider")
+
+// StateLocks lists the locks held on the terraform state of the layers.
+func (g GenericProvider) StateLocks(ctx context.Context) ([]StateLock, error) {
+	return nil, ErrStateLocksNotSupported
+}
+
+// ReleaseStateLock removes a lock from the terraform backend without running terraform.
+func (g GenericProvider) ReleaseStateLock(ctx context.Context, lock StateLock) error {
+	return ErrStateLocksNotSupported
+}
+
+// ForceUnlock releases a lock with terraform force-unlock, run in the workdir of its layer.
+func (g GenericProvider) ForceUnlock(ctx context.Context, lock StateLock) error {
+	wd := g.Caravan.LayerWorkdir(lock.Layer)
+	if wd == "" {
+		return fmt.Errorf("cannot unlock unknown deploy layer: %d", lock.Layer)
+	}
+	tf := g.executor()
+	if err := tf.Init(ctx, wd); err != nil {
+		return err
+	}
+	if err := tf.ForceUnlock(ctx, lock.ID, g.layerEnv(lock.Layer)); err != nil {
+		return fmt.Errorf("error unlocking terraform state of layer %s: %w", lock.Layer, err)
+	}
+	return nil
+}
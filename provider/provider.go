@@ -3,6 +3,7 @@ package provider
 
 import (
 	"caravan-cli/cli"
+	"caravan-cli/terraform"
 	"context"
 )
 
@@ -12,11 +13,24 @@ const (
 	Azure = "azure"
 )
 
+// RemoteStateObject is the name of the caravan state file copy kept in the provider's state store.
+const RemoteStateObject = "caravan/caravan.state"
+
 type WithDeploy interface {
 	// Deploy will execute the operations needed to deploy the different stack layers
 	Deploy(context.Context, cli.DeployLayer) error
 }
 
+type WithPlan interface {
+	// Plan will save the terraform plan of the given stack layer and summarize the planned changes
+	Plan(context.Context, cli.DeployLayer) (terraform.PlanSummary, error)
+}
+
+type WithOutputs interface {
+	// Outputs will read the terraform outputs of the given stack layer
+	Outputs(context.Context, cli.DeployLayer) (map[string]terraform.OutputValue, error)
+}
+
 type WithBake interface {
 	// Bake will execute the image baking procedures
 	Bake(context.Context) error
@@ -32,6 +46,26 @@ type WithDestroy interface {
 	Destroy(context.Context, cli.DeployLayer) error
 }
 
+type WithRemoteState interface {
+	// PullState will read the copy of the caravan state file kept in the provider's state store, and its version
+	PullState(context.Context) ([]byte, string, error)
+
+	// PushState will replace the copy of the caravan state file kept in the provider's state store,
+	// provided that it is still at the given version, and return the new version
+	PushState(context.Context, []byte, string) (string, error)
+}
+
+type WithStateLocks interface {
+	// StateLocks will list the locks held on the terraform state of the stack layers
+	StateLocks(context.Context) ([]StateLock, error)
+
+	// ReleaseStateLock will remove a lock from the terraform backend, without running terraform
+	ReleaseStateLock(context.Context, StateLock) error
+
+	// ForceUnlock will release a lock with terraform force-unlock
+	ForceUnlock(context.Context, StateLock) error
+}
+
 type Provider interface {
 	// GetTemplates returns the templates needed by the provider. The caller will handle persistence of the files.
 	GetTemplates(context.Context) ([]cli.Template, error)
@@ -45,8 +79,12 @@ type Provider interface {
 
 	WithBake
 
+	WithPlan
+
 	WithDeploy
 
+	WithOutputs
+
 	WithDestroy
 
 	// CleanProvider deletes cloud resources created during InitProvider
@@ -54,6 +92,10 @@ type Provider interface {
 
 	WithStatus
 
+	WithRemoteState
+
+	WithStateLocks
+
 	// Update upgrades versions etc...
 	// Update() error
 }
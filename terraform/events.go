@@ -0,0 +1,243 @@
+package terraform
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// MessageType is the type of a message of the terraform machine readable UI (-json).
+type MessageType string
+
+const (
+	MessageVersion       MessageType = "version"
+	MessageLog           MessageType = "log"
+	MessageDiagnostic    MessageType = "diagnostic"
+	MessagePlannedChange MessageType = "planned_change"
+	MessageChangeSummary MessageType = "change_summary"
+	MessageApplyStart    MessageType = "apply_start"
+	MessageApplyProgress MessageType = "apply_progress"
+	MessageApplyComplete MessageType = "apply_complete"
+	MessageApplyErrored  MessageType = "apply_errored"
+	MessageOutputs       MessageType = "outputs"
+)
+
+// Event is a typed message parsed from the terraform machine readable output.
+type Event interface {
+	// Raw returns the envelope of the original message.
+	Raw() Message
+}
+
+// Message is the envelope shared by all the terraform machine readable messages.
+type Message struct {
+	Level     string      `json:"@level"`
+	Text      string      `json:"@message"`
+	Module    string      `json:"@module"`
+	Timestamp time.Time   `json:"@timestamp"`
+	Type      MessageType `json:"type"`
+	Terraform string      `json:"terraform,omitempty"`
+
+	Hook       *hook       `json:"hook,omitempty"`
+	Diagnostic *Diagnostic `json:"diagnostic,omitempty"`
+	Changes    *Changes    `json:"changes,omitempty"`
+}
+
+func (m Message) Raw() Message {
+	return m
+}
+
+type hook struct {
+	Resource struct {
+		Addr         string `json:"addr"`
+		ResourceType string `json:"resource_type"`
+		ResourceName string `json:"resource_name"`
+	} `json:"resource"`
+	Action         string  `json:"action"`
+	IDKey          string  `json:"id_key"`
+	IDValue        string  `json:"id_value"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// ResourceStarted is emitted when terraform starts applying a change to a resource.
+type ResourceStarted struct {
+	Message
+	Address string
+	Action  string
+}
+
+// ResourceCompleted is emitted when terraform completes a change to a resource.
+type ResourceCompleted struct {
+	Message
+	Address string
+	Action  string
+	ID      string
+	Elapsed time.Duration
+}
+
+// ResourceErrored is emitted when terraform fails applying a change to a resource.
+type ResourceErrored struct {
+	Message
+	Address string
+	Action  string
+	Elapsed time.Duration
+}
+
+// Diagnostic is a warning or an error reported by terraform.
+type Diagnostic struct {
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	Detail   string `json:"detail"`
+	Address  string `json:"address,omitempty"`
+	Range    *struct {
+		Filename string `json:"filename"`
+		Start    struct {
+			Line int `json:"line"`
+		} `json:"start"`
+	} `json:"range,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	s := d.Summary
+	if d.Range != nil {
+		s = fmt.Sprintf("%s (%s:%d)", s, d.Range.Filename, d.Range.Start.Line)
+	}
+	if d.Detail != "" {
+		s = s + ": " + d.Detail
+	}
+	return s
+}
+
+// DiagnosticEvent wraps a diagnostic reported by terraform.
+type DiagnosticEvent struct {
+	Message
+	Diagnostic
+}
+
+// Changes counts the resources added, changed and removed by a plan or an apply.
+type Changes struct {
+	Add       int    `json:"add"`
+	Change    int    `json:"change"`
+	Remove    int    `json:"remove"`
+	Operation string `json:"operation"`
+}
+
+// ChangeSummary is emitted at the end of a plan, apply or destroy.
+type ChangeSummary struct {
+	Message
+	Changes
+}
+
+// ParseEvent decodes a single line of terraform machine readable output.
+func ParseEvent(line []byte) (Event, error) {
+	m := Message{}
+	if err := json.Unmarshal(line, &m); err != nil {
+		return nil, fmt.Errorf("unable to parse terraform message: %w", err)
+	}
+	switch m.Type {
+	case MessageApplyStart:
+		if m.Hook != nil {
+			return ResourceStarted{Message: m, Address: m.Hook.Resource.Addr, Action: m.Hook.Action}, nil
+		}
+	case MessageApplyComplete:
+		if m.Hook != nil {
+			return ResourceCompleted{
+				Message: m,
+				Address: m.Hook.Resource.Addr,
+				Action:  m.Hook.Action,
+				ID:      m.Hook.IDValue,
+				Elapsed: seconds(m.Hook.ElapsedSeconds),
+			}, nil
+		}
+	case MessageApplyErrored:
+		if m.Hook != nil {
+			return ResourceErrored{Message: m, Address: m.Hook.Resource.Addr, Action: m.Hook.Action, Elapsed: seconds(m.Hook.ElapsedSeconds)}, nil
+		}
+	case MessageDiagnostic:
+		if m.Diagnostic != nil {
+			return DiagnosticEvent{Message: m, Diagnostic: *m.Diagnostic}, nil
+		}
+	case MessageChangeSummary:
+		if m.Changes != nil {
+			return ChangeSummary{Message: m, Changes: *m.Changes}, nil
+		}
+	}
+	return m, nil
+}
+
+// ParseEvents decodes the terraform machine readable stream calling fn for each event.
+// Lines that are not JSON messages are passed to fn as log messages.
+func ParseEvents(r io.Reader, fn func(Event)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if strings.TrimSpace(string(line)) == "" {
+			continue
+		}
+		e, err := ParseEvent(line)
+		if err != nil {
+			e = Message{Level: "info", Text: string(line), Type: MessageLog}
+		}
+		fn(e)
+	}
+	return scanner.Err()
+}
+
+// LogEvent forwards a terraform event to the logger.
+func LogEvent(e Event) {
+	switch ev := e.(type) {
+	case ResourceStarted:
+		log.Info().Str("resource", ev.Address).Str("action", ev.Action).Msgf("%s: %s started", ev.Address, ev.Action)
+	case ResourceCompleted:
+		log.Info().Str("resource", ev.Address).Str("action", ev.Action).Dur("elapsed", ev.Elapsed).Msgf("%s: %s completed after %s", ev.Address, ev.Action, ev.Elapsed)
+	case ResourceErrored:
+		log.Error().Str("resource", ev.Address).Str("action", ev.Action).Dur("elapsed", ev.Elapsed).Msgf("%s: %s errored after %s", ev.Address, ev.Action, ev.Elapsed)
+	case DiagnosticEvent:
+		l := log.Warn()
+		if ev.Severity == "error" {
+			l = log.Error()
+		}
+		l.Str("severity", ev.Severity).Str("resource", ev.Address).Msgf("%s", ev.Diagnostic)
+	case ChangeSummary:
+		log.Info().Str("operation", ev.Operation).Int("add", ev.Add).Int("change", ev.Change).Int("remove", ev.Remove).Msgf("%s", ev.Text)
+	default:
+		m := e.Raw()
+		level, err := zerolog.ParseLevel(m.Level)
+		if err != nil || level == zerolog.NoLevel {
+			level = zerolog.InfoLevel
+		}
+		// only planned changes are worth reporting among the informational messages
+		if level == zerolog.InfoLevel && m.Type != MessagePlannedChange {
+			level = zerolog.DebugLevel
+		}
+		log.WithLevel(level).Str("type", string(m.Type)).Msgf("%s", m.Text)
+	}
+}
+
+// DiagnosticsError collects the error diagnostics reported by a failed terraform command.
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+	Err         error
+}
+
+func (e DiagnosticsError) Error() string {
+	s := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		s = append(s, d.String())
+	}
+	return fmt.Sprintf("%s: %s", e.Err, strings.Join(s, "; "))
+}
+
+func (e DiagnosticsError) Unwrap() error {
+	return e.Err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
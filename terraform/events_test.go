@@ -0,0 +1,68 @@
+package terraform_test
+
+import (
+	"caravan-cli/terraform"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEvents(t *testing.T) {
+	stream := `{"@level":"info","@message":"Terraform 1.4.6","@module":"terraform.ui","@timestamp":"2023-05-30T10:00:00.000000+02:00","terraform":"1.4.6","type":"version","ui":"1.1"}
+{"@level":"info","@message":"aws_lb.hashicorp_alb: Creating...","@module":"terraform.ui","hook":{"resource":{"addr":"aws_lb.hashicorp_alb","resource_type":"aws_lb","resource_name":"hashicorp_alb"},"action":"create"},"type":"apply_start"}
+{"@level":"info","@message":"aws_lb.hashicorp_alb: Creation complete after 2m3s [id=arn]","@module":"terraform.ui","hook":{"resource":{"addr":"aws_lb.hashicorp_alb"},"action":"create","id_key":"id","id_value":"arn","elapsed_seconds":123},"type":"apply_complete"}
+{"@level":"error","@message":"aws_instance.server: Creation errored after 1s","@module":"terraform.ui","hook":{"resource":{"addr":"aws_instance.server"},"action":"create","elapsed_seconds":1},"type":"apply_errored"}
+{"@level":"error","@message":"Error: creating EC2 Instance","@module":"terraform.ui","diagnostic":{"severity":"error","summary":"creating EC2 Instance","detail":"InvalidAMIID.NotFound","address":"aws_instance.server","range":{"filename":"main.tf","start":{"line":12}}},"type":"diagnostic"}
+{"@level":"info","@message":"Apply complete! Resources: 1 added, 0 changed, 0 destroyed.","@module":"terraform.ui","changes":{"add":1,"change":0,"remove":0,"operation":"apply"},"type":"change_summary"}
+not a json line
+`
+	events := []terraform.Event{}
+	if err := terraform.ParseEvents(strings.NewReader(stream), func(e terraform.Event) {
+		events = append(events, e)
+	}); err != nil {
+		t.Fatalf("error parsing events: %s", err)
+	}
+	if len(events) != 7 {
+		t.Fatalf("got %d events but wanted %d", len(events), 7)
+	}
+
+	if m, ok := events[0].(terraform.Message); !ok || m.Terraform != "1.4.6" {
+		t.Errorf("version event not parsed: %#v", events[0])
+	}
+	if e, ok := events[1].(terraform.ResourceStarted); !ok || e.Address != "aws_lb.hashicorp_alb" || e.Action != "create" {
+		t.Errorf("resource started event not parsed: %#v", events[1])
+	}
+	if e, ok := events[2].(terraform.ResourceCompleted); !ok || e.ID != "arn" || e.Elapsed != 123*time.Second {
+		t.Errorf("resource completed event not parsed: %#v", events[2])
+	}
+	if e, ok := events[3].(terraform.ResourceErrored); !ok || e.Address != "aws_instance.server" {
+		t.Errorf("resource errored event not parsed: %#v", events[3])
+	}
+	d, ok := events[4].(terraform.DiagnosticEvent)
+	if !ok || d.Severity != "error" {
+		t.Fatalf("diagnostic event not parsed: %#v", events[4])
+	}
+	if got, want := d.Diagnostic.String(), "creating EC2 Instance (main.tf:12): InvalidAMIID.NotFound"; got != want {
+		t.Errorf("got %s but wanted %s", got, want)
+	}
+	if e, ok := events[5].(terraform.ChangeSummary); !ok || e.Add != 1 || e.Operation != "apply" {
+		t.Errorf("change summary event not parsed: %#v", events[5])
+	}
+	if e := events[6].Raw(); e.Type != terraform.MessageLog || e.Text != "not a json line" {
+		t.Errorf("plain text line not preserved: %#v", e)
+	}
+}
+
+func TestParseLockInfo(t *testing.T) {
+	b := []byte(`{"ID":"5f4b2c1e","Operation":"OperationTypeApply","Info":"","Who":"user@host","Version":"1.4.6","Created":"2023-05-04T10:00:00Z","Path":"bucket/platform/terraform/state/terraform.tfstate"}`)
+	l, err := terraform.ParseLockInfo(b)
+	if err != nil {
+		t.Fatalf("unable to parse lock info: %s", err)
+	}
+	if l.ID != "5f4b2c1e" || l.Who != "user@host" || l.Created.IsZero() {
+		t.Errorf("lock info not parsed: %+v", l)
+	}
+	if _, err := terraform.ParseLockInfo([]byte(`{}`)); err == nil {
+		t.Errorf("lock info without ID accepted")
+	}
+}
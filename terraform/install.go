@@ -0,0 +1,242 @@
+package terraform
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ReleasesURL is where HashiCorp publishes the terraform releases.
+	ReleasesURL = "https://releases.hashicorp.com"
+	// HashiCorpKeyURL is where HashiCorp publishes the public key signing the releases.
+	HashiCorpKeyURL = "https://www.hashicorp.com/.well-known/pgp-key.txt"
+	// HashiCorpFingerprint is the fingerprint of the HashiCorp release signing key.
+	HashiCorpFingerprint = "C874011F0AB405110D02105534365D9472D7468F"
+	// KeyFile is the name of the HashiCorp public key in the cache directory.
+	KeyFile = "hashicorp.asc"
+)
+
+var versionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.]+)?$`)
+
+// Installer downloads and verifies the terraform releases.
+type Installer struct {
+	// Dir is where the terraform binaries are installed, one directory per version.
+	Dir string
+	// CacheDir keeps the downloaded release files, the signing key included, for later offline installs.
+	CacheDir string
+	// Offline installs from CacheDir only, without any download.
+	Offline bool
+	// ReleasesURL and KeyURL default to the HashiCorp ones.
+	ReleasesURL string
+	KeyURL      string
+	// Fingerprint is the fingerprint of the key the checksums must be signed with, the HashiCorp one by default.
+	Fingerprint string
+	Client      *http.Client
+}
+
+// NewInstaller returns an installer of the HashiCorp releases into the given directory.
+func NewInstaller(dir, cacheDir string, offline bool) *Installer {
+	return &Installer{
+		Dir:         dir,
+		CacheDir:    cacheDir,
+		Offline:     offline,
+		ReleasesURL: ReleasesURL,
+		KeyURL:      HashiCorpKeyURL,
+		Fingerprint: HashiCorpFingerprint,
+		Client:      http.DefaultClient,
+	}
+}
+
+// Path returns where the binary of the given version is installed.
+func (i *Installer) Path(version string) string {
+	bin := "terraform"
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+	return filepath.Join(i.Dir, version, bin)
+}
+
+// Install makes the given terraform version available, verifying the signature of the release
+// checksums and the checksum of the release archive. It returns the path of the binary.
+func (i *Installer) Install(ctx context.Context, version string) (string, error) {
+	if !versionRegexp.MatchString(version) {
+		return "", fmt.Errorf("invalid terraform version: %s", version)
+	}
+	path := i.Path(version)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	log.Info().Msgf("installing terraform %s in %s", version, filepath.Dir(path))
+
+	archive := fmt.Sprintf("terraform_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH)
+	sums := fmt.Sprintf("terraform_%s_SHA256SUMS", version)
+	releaseURL := fmt.Sprintf("%s/terraform/%s/", strings.TrimSuffix(i.ReleasesURL, "/"), version)
+
+	key, err := i.fetch(ctx, KeyFile, i.KeyURL)
+	if err != nil {
+		return "", err
+	}
+	sumsData, err := i.fetch(ctx, sums, releaseURL+sums)
+	if err != nil {
+		return "", err
+	}
+	sig, err := i.fetch(ctx, sums+".sig", releaseURL+sums+".sig")
+	if err != nil {
+		return "", err
+	}
+	if err := i.verifySignature(key, sumsData, sig); err != nil {
+		return "", fmt.Errorf("error verifying %s: %w", sums, err)
+	}
+	want, err := checksum(sumsData, archive)
+	if err != nil {
+		return "", err
+	}
+	zipData, err := i.fetch(ctx, archive, releaseURL+archive)
+	if err != nil {
+		return "", err
+	}
+	if got := sha256.Sum256(zipData); hex.EncodeToString(got[:]) != want {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s want %s", archive, hex.EncodeToString(got[:]), want)
+	}
+
+	if err := extract(zipData, filepath.Base(path), path); err != nil {
+		return "", fmt.Errorf("error extracting %s: %w", archive, err)
+	}
+	return path, nil
+}
+
+// fetch reads the named file from the cache or, when online, downloads it and stores it in the cache.
+func (i *Installer) fetch(ctx context.Context, name, url string) ([]byte, error) {
+	if i.CacheDir != "" {
+		data, err := os.ReadFile(filepath.Join(i.CacheDir, name))
+		if err == nil {
+			return data, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if i.Offline {
+		return nil, fmt.Errorf("%s not found in cache directory %q while offline", name, i.CacheDir)
+	}
+
+	log.Debug().Msgf("downloading %s", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", url, err)
+	}
+
+	if i.CacheDir != "" {
+		if err := os.MkdirAll(i.CacheDir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(i.CacheDir, name), data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// verifySignature checks the detached signature with the keys of the armored key ring matching
+// the pinned fingerprint, so that a tampered key cannot sign the checksums.
+func (i *Installer) verifySignature(armoredKey, signed, sig []byte) error {
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKey))
+	if err != nil {
+		return fmt.Errorf("error reading signing key: %w", err)
+	}
+	trusted := openpgp.EntityList{}
+	for _, k := range keys {
+		if strings.EqualFold(fmt.Sprintf("%X", k.PrimaryKey.Fingerprint), i.Fingerprint) {
+			trusted = append(trusted, k)
+		}
+	}
+	if len(trusted) == 0 {
+		return fmt.Errorf("no signing key with fingerprint %s", i.Fingerprint)
+	}
+	if _, err := openpgp.CheckDetachedSignature(trusted, bytes.NewReader(signed), bytes.NewReader(sig), nil); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	return nil
+}
+
+// checksum returns the checksum of the named file from a SHA256SUMS file.
+func checksum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum found for %s", name)
+}
+
+// extract writes the named file of the zip archive to dest as an executable.
+func extract(data []byte, name, dest string) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, f := range r.File {
+		if f.Name != name {
+			continue
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(dest), ".terraform-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		// nolint:gosec // the archive checksum has been verified
+		if _, err := io.Copy(tmp, src); err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+			return err
+		}
+		return os.Rename(tmp.Name(), dest)
+	}
+	return fmt.Errorf("%s not found in archive", name)
+}
@@ -0,0 +1,134 @@
+package terraform_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"caravan-cli/terraform"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+const version = "1.2.3"
+
+// release serves a signed terraform release, returning the installer configured to trust the signing key.
+func release(t *testing.T, tamper bool) (*terraform.Installer, *int) {
+	t.Helper()
+	key, err := openpgp.NewEntity("releases", "", "releases@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("terraform")
+	_, _ = f.Write([]byte("#!/bin/sh\necho terraform\n"))
+	zw.Close()
+
+	name := fmt.Sprintf("terraform_%s_%s_%s.zip", version, runtime.GOOS, runtime.GOARCH)
+	sum := sha256.Sum256(archive.Bytes())
+	sums := []byte(fmt.Sprintf("%x  %s\n%x  terraform_%s_other_arch.zip\n", sum, name, sum, version))
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, key, bytes.NewReader(sums), nil); err != nil {
+		t.Fatal(err)
+	}
+	if tamper {
+		archive.WriteString("tampered")
+	}
+
+	files := map[string][]byte{
+		"/key": armored.Bytes(),
+		fmt.Sprintf("/terraform/%s/terraform_%s_SHA256SUMS", version, version):     sums,
+		fmt.Sprintf("/terraform/%s/terraform_%s_SHA256SUMS.sig", version, version): sig.Bytes(),
+		fmt.Sprintf("/terraform/%s/%s", version, name):                             archive.Bytes(),
+	}
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		downloads++
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	i := terraform.NewInstaller(filepath.Join(dir, "bin"), filepath.Join(dir, "cache"), false)
+	i.ReleasesURL = srv.URL
+	i.KeyURL = srv.URL + "/key"
+	i.Fingerprint = fmt.Sprintf("%X", key.PrimaryKey.Fingerprint)
+	return i, &downloads
+}
+
+func TestInstall(t *testing.T) {
+	ctx := context.Background()
+	i, downloads := release(t, false)
+
+	path, err := i.Install(ctx, version)
+	if err != nil {
+		t.Fatalf("error installing terraform: %s", err)
+	}
+	if path != i.Path(version) {
+		t.Errorf("got path %s but wanted %s", path, i.Path(version))
+	}
+	if st, err := os.Stat(path); err != nil || st.Mode()&0o100 == 0 {
+		t.Errorf("terraform binary not installed as executable: %v", err)
+	}
+	if *downloads != 4 {
+		t.Errorf("got %d downloads but wanted 4", *downloads)
+	}
+
+	// offline from the cache seeded by the first install
+	if err := os.RemoveAll(i.Dir); err != nil {
+		t.Fatal(err)
+	}
+	i.Offline = true
+	if _, err := i.Install(ctx, version); err != nil {
+		t.Fatalf("error installing terraform offline: %s", err)
+	}
+	if *downloads != 4 {
+		t.Errorf("downloaded %d files while offline", *downloads-4)
+	}
+	if _, err := i.Install(ctx, "1.2.4"); err == nil {
+		t.Errorf("installed a version missing from the cache while offline")
+	}
+}
+
+func TestInstallVerify(t *testing.T) {
+	ctx := context.Background()
+
+	i, _ := release(t, true)
+	if _, err := i.Install(ctx, version); err == nil {
+		t.Errorf("installed an archive with a wrong checksum")
+	}
+
+	i, _ = release(t, false)
+	i.Fingerprint = terraform.HashiCorpFingerprint
+	if _, err := i.Install(ctx, version); err == nil {
+		t.Errorf("installed a release signed with an untrusted key")
+	}
+
+	if _, err := i.Install(ctx, "../1.2.3"); err == nil {
+		t.Errorf("installed an invalid version")
+	}
+}
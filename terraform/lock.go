@@ -0,0 +1,58 @@
+package terraform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LockInfo is the information terraform keeps with a state lock.
+type LockInfo struct {
+	ID        string
+	Operation string
+	Info      string
+	Who       string
+	Version   string
+	Created   time.Time
+	Path      string
+}
+
+// ParseLockInfo reads the lock information saved by terraform in a backend.
+func ParseLockInfo(b []byte) (LockInfo, error) {
+	l := LockInfo{}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return l, fmt.Errorf("error parsing terraform lock info: %w", err)
+	}
+	if l.ID == "" {
+		return l, fmt.Errorf("terraform lock info without ID: %s", b)
+	}
+	return l, nil
+}
+
+// ForceUnlock releases the state lock with the given ID held on the backend of the workdir.
+func (t Terraform) ForceUnlock(ctx context.Context, id string, env map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Second)
+	defer cancel()
+
+	log.Info().Msgf("running force-unlock on workdir: %s for lock %s", t.Workdir, id)
+	cmd := t.command("force-unlock", "-force", id)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := runCommand(ctx, cmd); err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return fmt.Errorf("%w: %s", err, s)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GracePeriod is the time terraform is given to exit once interrupted, before it is killed.
+var GracePeriod = 5 * time.Minute
+
+type killKey struct{}
+
+// WithKill returns a context that kills terraform as soon as kill is closed, instead of waiting
+// the grace period after an interruption.
+func WithKill(ctx context.Context, kill <-chan struct{}) context.Context {
+	return context.WithValue(ctx, killKey{}, kill)
+}
+
+func killed(ctx context.Context) <-chan struct{} {
+	kill, _ := ctx.Value(killKey{}).(<-chan struct{})
+	return kill
+}
+
+// command returns the terraform command with the given arguments, run in the workdir and in its own
+// process group, so that the signals of the terminal only reach caravan.
+func (t Terraform) command(args ...string) *exec.Cmd {
+	cmd := exec.Command(t.bin(), args...)
+	cmd.Dir = t.Workdir
+	cmd.SysProcAttr = sysProcAttr()
+	return cmd
+}
+
+// follow makes the started command follow the context: once the context is done terraform is interrupted,
+// to let it release the state lock and persist the state, and it is killed if it is still running after
+// GracePeriod or when the context kill channel is closed. The returned function must be called once the
+// command has exited.
+func follow(ctx context.Context, cmd *exec.Cmd) (exited func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		log.Warn().Msgf("interrupting terraform (pid %d): waiting for it to release the state lock", cmd.Process.Pid)
+		if err := interrupt(cmd.Process); err != nil {
+			log.Warn().Msgf("unable to interrupt terraform: %s", err)
+		}
+		grace := time.NewTimer(GracePeriod)
+		defer grace.Stop()
+		select {
+		case <-done:
+			return
+		case <-grace.C:
+		case <-killed(ctx):
+		}
+		log.Warn().Msgf("killing terraform (pid %d): its state lock may have to be released by hand", cmd.Process.Pid)
+		_ = cmd.Process.Kill()
+	}()
+	return func() { close(done) }
+}
+
+// runCommand runs the command following the context.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := follow(ctx, cmd)
+	err := cmd.Wait()
+	exited()
+	return interrupted(ctx, err)
+}
+
+// interrupted reports the error of a command stopped because the context is done.
+func interrupted(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("terraform interrupted: %w (%s)", ctx.Err(), err)
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package terraform
+
+import (
+	"os"
+	"syscall"
+)
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func interrupt(p *os.Process) error {
+	return p.Signal(os.Interrupt)
+}
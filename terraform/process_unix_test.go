@@ -0,0 +1,87 @@
+//go:build !windows
+
+package terraform_test
+
+import (
+	"caravan-cli/terraform"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTerraform writes a terraform script running until it is interrupted.
+func fakeTerraform(t *testing.T, onInterrupt string) (dir, bin string) {
+	t.Helper()
+	dir = t.TempDir()
+	bin = filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\ntrap '" + onInterrupt + "' INT\nwhile true; do sleep 0.05; done\n"
+	if err := os.WriteFile(bin, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return dir, bin
+}
+
+func TestInterrupt(t *testing.T) {
+	dir, bin := fakeTerraform(t, "touch released; exit 1")
+	tf := terraform.New("info", terraform.WithBinary(bin))
+	tf.Workdir = dir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	err := tf.ApplyVarFile(ctx, "vars.tfvars", time.Minute, nil, "*")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v but wanted an interruption", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "released")); err != nil {
+		t.Errorf("terraform not interrupted gracefully: %s", err)
+	}
+}
+
+func TestKill(t *testing.T) {
+	dir, bin := fakeTerraform(t, "")
+	tf := terraform.New("info", terraform.WithBinary(bin))
+	tf.Workdir = dir
+
+	kill := make(chan struct{})
+	ctx, cancel := context.WithCancel(terraform.WithKill(context.Background(), kill))
+	time.AfterFunc(100*time.Millisecond, cancel)
+	time.AfterFunc(300*time.Millisecond, func() { close(kill) })
+
+	start := time.Now()
+	err := tf.ApplyVarFile(ctx, "vars.tfvars", time.Minute, nil, "*")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v but wanted an interruption", err)
+	}
+	if d := time.Since(start); d > terraform.GracePeriod/2 {
+		t.Errorf("terraform killed after %s", d)
+	}
+}
+
+func TestApplyPlanArgs(t *testing.T) {
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\" >> args; done\n"
+	if err := os.WriteFile(bin, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tf := terraform.New("info", terraform.WithBinary(bin))
+	tf.Workdir = dir
+
+	if err := tf.ApplyPlan(context.Background(), "platform.tfplan", time.Minute, nil); err != nil {
+		t.Fatalf("error applying plan: %s", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(b)), "\n")
+	want := []string{"apply", "-json", "-input=false", "platform.tfplan"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got args %q but wanted %q", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package terraform
+
+import (
+	"os"
+	"syscall"
+)
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// interrupt cannot deliver an interrupt to a single process on windows: terraform receives the one
+// of the console and is killed only after the grace period.
+func interrupt(p *os.Process) error {
+	return nil
+}
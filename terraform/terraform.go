@@ -2,23 +2,79 @@
 package terraform
 
 import (
+	"bytes"
 	"caravan-cli/cli"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// PlanSummary reports the number of resources a saved plan is going to add, change and destroy.
+type PlanSummary struct {
+	Add     int
+	Change  int
+	Destroy int
+}
+
+func (p PlanSummary) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy", p.Add, p.Change, p.Destroy)
+}
+
+// Executor runs the terraform commands of a workdir: Init selects the workdir the following commands run in.
+type Executor interface {
+	Init(ctx context.Context, wd string) error
+	ApplyVarFile(ctx context.Context, file string, timeout time.Duration, env map[string]string, target string) error
+	ApplyPlan(ctx context.Context, plan string, timeout time.Duration, env map[string]string) error
+	Destroy(ctx context.Context, file string, env map[string]string) error
+	Plan(ctx context.Context, file, out string, env map[string]string) (PlanSummary, error)
+	Output(ctx context.Context, env map[string]string) (map[string]OutputValue, error)
+	ForceUnlock(ctx context.Context, id string, env map[string]string) error
+}
+
+// OutputValue is a root module output as reported by terraform output.
+type OutputValue struct {
+	Sensitive bool            `json:"sensitive"`
+	Type      json.RawMessage `json:"type"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// Terraform is the Executor running the terraform binary.
 type Terraform struct {
 	Workdir  string
 	logLevel string
+	binary   string
+}
+
+var _ Executor = (*Terraform)(nil)
+
+func New(logLevel string, options ...func(*Terraform)) (t *Terraform) {
+	t = &Terraform{logLevel: logLevel}
+	for _, op := range options {
+		if op != nil {
+			op(t)
+		}
+	}
+	return t
+}
+
+// WithBinary runs the given terraform binary instead of the one found in $PATH.
+func WithBinary(path string) func(*Terraform) {
+	return func(t *Terraform) {
+		t.binary = path
+	}
 }
 
-func New(logLevel string) (t *Terraform) {
-	return &Terraform{logLevel: logLevel}
+func (t Terraform) bin() string {
+	if t.binary == "" {
+		return "terraform"
+	}
+	return t.binary
 }
 
 func (t *Terraform) Init(ctx context.Context, wd string) (err error) {
@@ -27,13 +83,12 @@ func (t *Terraform) Init(ctx context.Context, wd string) (err error) {
 
 	t.Workdir = wd
 	log.Info().Msgf("running init on workdir: %s", t.Workdir)
-	cmd := exec.CommandContext(ctx, "terraform", "init", "-upgrade")
-	cmd.Dir = t.Workdir
+	cmd := t.command("init", "-upgrade")
 	if t.logLevel == cli.LogLevelDebug {
 		cmd.Stdout = os.Stdout
 	}
 	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	err = runCommand(ctx, cmd)
 	if err != nil {
 		return err
 	}
@@ -51,18 +106,8 @@ func (t Terraform) ApplyVarMap(ctx context.Context, config map[string]string) (e
 		args = append(args, fmt.Sprintf("-var=%s=%s", k, v))
 	}
 	log.Info().Msgf("running apply on workdir: %s with args: %s", t.Workdir, args)
-	cmd := exec.CommandContext(ctx, "terraform", args...)
-	cmd.Dir = t.Workdir
-
-	if t.logLevel == cli.LogLevelDebug {
-		cmd.Stdout = os.Stdout
-	}
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = t.run(ctx, args, nil)
+	return err
 }
 
 func (t Terraform) ApplyVarFile(ctx context.Context, file string, timeout time.Duration, env map[string]string, target string) (err error) {
@@ -77,21 +122,8 @@ func (t Terraform) ApplyVarFile(ctx context.Context, file string, timeout time.D
 		args = append(args, "-target="+target)
 	}
 	log.Info().Msgf("running apply on workdir: %s with args: %s", t.Workdir, args)
-	cmd := exec.CommandContext(ctx, "terraform", args...)
-	cmd.Dir = t.Workdir
-	cmd.Env = os.Environ()
-	for k, v := range env {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-	}
-	if t.logLevel == cli.LogLevelDebug {
-		cmd.Stdout = os.Stdout
-	}
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err = t.run(ctx, args, env)
+	return err
 }
 
 func (t Terraform) Destroy(ctx context.Context, file string, env map[string]string) (err error) {
@@ -103,19 +135,125 @@ func (t Terraform) Destroy(ctx context.Context, file string, env map[string]stri
 	args = append(args, "-auto-approve")
 	args = append(args, "-var-file="+file)
 	log.Info().Msgf("running destroy on workdir: %s with args: %s", t.Workdir, args)
-	cmd := exec.CommandContext(ctx, "terraform", args...)
-	cmd.Dir = t.Workdir
+	_, err = t.run(ctx, args, env)
+	return err
+}
+
+// Plan computes the changes for the given var file and saves the resulting plan in the out file.
+func (t Terraform) Plan(ctx context.Context, file, out string, env map[string]string) (s PlanSummary, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 600*time.Second)
+	defer cancel()
+
+	args := []string{}
+	args = append(args, "plan")
+	args = append(args, "-input=false")
+	args = append(args, "-var-file="+file)
+	args = append(args, "-out="+out)
+	log.Info().Msgf("running plan on workdir: %s with args: %s", t.Workdir, args)
+	changes, err := t.run(ctx, args, env)
+	if err != nil {
+		return s, err
+	}
+	if changes == nil {
+		return s, fmt.Errorf("no change summary reported by terraform plan")
+	}
+	return PlanSummary{Add: changes.Add, Change: changes.Change, Destroy: changes.Remove}, nil
+}
+
+// ApplyPlan applies a plan previously saved with Plan.
+func (t Terraform) ApplyPlan(ctx context.Context, plan string, timeout time.Duration, env map[string]string) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{}
+	args = append(args, "apply")
+	args = append(args, "-input=false")
+	args = append(args, plan)
+	log.Info().Msgf("running apply on workdir: %s with args: %s", t.Workdir, args)
+	_, err = t.run(ctx, args, env)
+	return err
+}
+
+// Output returns the outputs of the root module of the workdir.
+func (t Terraform) Output(ctx context.Context, env map[string]string) (outputs map[string]OutputValue, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Second)
+	defer cancel()
+
+	log.Info().Msgf("running output on workdir: %s", t.Workdir)
+	cmd := t.command("output", "-json")
 	cmd.Env = os.Environ()
 	for k, v := range env {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
 	}
-	if t.logLevel == cli.LogLevelDebug {
-		cmd.Stdout = os.Stdout
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(ctx, cmd); err != nil {
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return nil, fmt.Errorf("%w: %s", err, s)
+		}
+		return nil, err
 	}
-	cmd.Stderr = os.Stderr
-	err = cmd.Run()
+	if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
+		return nil, fmt.Errorf("error parsing terraform outputs: %w", err)
+	}
+	return outputs, nil
+}
+
+// run executes terraform with machine readable output, forwarding the parsed events to the logger.
+// It returns the change summary reported by terraform, if any, and an error carrying
+// the error diagnostics when the command fails.
+func (t Terraform) run(ctx context.Context, args []string, env map[string]string) (changes *Changes, err error) {
+	// flags must come before the positional arguments, e.g. the plan file of apply
+	args = append([]string{args[0], "-json"}, args[1:]...)
+	cmd := t.command(args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exited := follow(ctx, cmd)
+
+	diags := []Diagnostic{}
+	perr := ParseEvents(stdout, func(e Event) {
+		LogEvent(e)
+		switch ev := e.(type) {
+		case DiagnosticEvent:
+			if ev.Severity == "error" {
+				diags = append(diags, ev.Diagnostic)
+			}
+		case ChangeSummary:
+			c := ev.Changes
+			changes = &c
+		}
+	})
+	if perr != nil {
+		// drain the output to let terraform complete
+		_, _ = io.Copy(io.Discard, stdout)
+		log.Warn().Msgf("error reading terraform output: %s", perr)
+	}
+
+	err = interrupted(ctx, cmd.Wait())
+	exited()
+	if s := strings.TrimSpace(stderr.String()); s != "" {
+		log.Debug().Msgf("terraform stderr: %s", s)
+	}
+	if err != nil {
+		if len(diags) > 0 {
+			return changes, DiagnosticsError{Diagnostics: diags, Err: err}
+		}
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			return changes, fmt.Errorf("%w: %s", err, s)
+		}
+		return changes, err
+	}
+	return changes, nil
 }
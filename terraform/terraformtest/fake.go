@@ -0,0 +1,124 @@
+// Terraformtest provides a recording terraform executor for offline tests.
+package terraformtest
+
+import (
+	"caravan-cli/terraform"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Call is a terraform command received by the fake.
+type Call struct {
+	Command string
+	Workdir string
+	VarFile string
+	Target  string
+	Plan    string
+	LockID  string
+	Env     map[string]string
+}
+
+func (c Call) String() string {
+	return fmt.Sprintf("%s workdir=%s var-file=%s target=%s plan=%s lock=%s env=%v", c.Command, c.Workdir, c.VarFile, c.Target, c.Plan, c.LockID, c.Env)
+}
+
+// Fake is a terraform.Executor recording the commands it receives instead of running terraform.
+type Fake struct {
+	// Errors are returned by the commands with the given name, e.g. "apply".
+	Errors map[string]error
+	// Summary is returned by Plan.
+	Summary terraform.PlanSummary
+	// Outputs are returned by Output, by workdir.
+	Outputs map[string]map[string]terraform.OutputValue
+
+	mu      sync.Mutex
+	workdir string
+	calls   []Call
+}
+
+var _ terraform.Executor = (*Fake)(nil)
+
+func (f *Fake) record(c Call) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c.Command == "init" {
+		f.workdir = c.Workdir
+	}
+	c.Workdir = f.workdir
+	f.calls = append(f.calls, c)
+	return f.Errors[c.Command]
+}
+
+// Calls returns the commands received so far.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call{}, f.calls...)
+}
+
+// AssertCalls checks that the commands received so far are exactly the wanted ones. A nil Env
+// in a wanted call matches any environment.
+func (f *Fake) AssertCalls(t testing.TB, want ...Call) {
+	t.Helper()
+	got := f.Calls()
+	for i := 0; i < len(got) || i < len(want); i++ {
+		switch {
+		case i >= len(got):
+			t.Errorf("missing terraform call %d: %s", i, want[i])
+		case i >= len(want):
+			t.Errorf("unexpected terraform call %d: %s", i, got[i])
+		default:
+			g, w := got[i], want[i]
+			if w.Env == nil {
+				g.Env = nil
+			}
+			if !reflect.DeepEqual(g, w) {
+				t.Errorf("terraform call %d:\ngot  %s\nwant %s", i, got[i], w)
+			}
+		}
+	}
+}
+
+func (f *Fake) Init(ctx context.Context, wd string) error {
+	return f.record(Call{Command: "init", Workdir: wd})
+}
+
+func (f *Fake) ApplyVarFile(ctx context.Context, file string, timeout time.Duration, env map[string]string, target string) error {
+	return f.record(Call{Command: "apply", VarFile: file, Target: target, Env: copyEnv(env)})
+}
+
+func (f *Fake) ApplyPlan(ctx context.Context, plan string, timeout time.Duration, env map[string]string) error {
+	return f.record(Call{Command: "apply", Plan: plan, Env: copyEnv(env)})
+}
+
+func (f *Fake) Destroy(ctx context.Context, file string, env map[string]string) error {
+	return f.record(Call{Command: "destroy", VarFile: file, Env: copyEnv(env)})
+}
+
+func (f *Fake) Plan(ctx context.Context, file, out string, env map[string]string) (terraform.PlanSummary, error) {
+	err := f.record(Call{Command: "plan", VarFile: file, Plan: out, Env: copyEnv(env)})
+	return f.Summary, err
+}
+
+func (f *Fake) Output(ctx context.Context, env map[string]string) (map[string]terraform.OutputValue, error) {
+	err := f.record(Call{Command: "output", Env: copyEnv(env)})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Outputs[f.workdir], err
+}
+
+func (f *Fake) ForceUnlock(ctx context.Context, id string, env map[string]string) error {
+	return f.record(Call{Command: "force-unlock", LockID: id, Env: copyEnv(env)})
+}
+
+func copyEnv(env map[string]string) map[string]string {
+	c := map[string]string{}
+	for k, v := range env {
+		c[k] = v
+	}
+	return c
+}
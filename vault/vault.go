@@ -37,15 +37,20 @@ func New(url string, token string, ca string) (v Vault, err error) {
 	}, nil
 }
 
-// GetToken retrieves the token from a Vault server.
+// GetToken retrieves the token from a Vault server, as issued by the Nomad (secret_id) or the
+// Consul (token) secrets engine.
 func (v Vault) GetToken(path string) (token string, err error) {
 	s, err := v.Client.Read(path)
 	if err != nil {
 		return "", err
 	}
-	t := s.Data["secret_id"].(string)
-	if err != nil {
-		return "", err
+	if s == nil {
+		return "", fmt.Errorf("no secret found at %s", path)
+	}
+	for _, k := range []string{"secret_id", "token"} {
+		if t, ok := s.Data[k].(string); ok {
+			return t, nil
+		}
 	}
-	return t, nil
+	return "", fmt.Errorf("no token found at %s", path)
 }
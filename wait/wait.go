@@ -0,0 +1,116 @@
+// Wait polls a condition with a bounded exponential backoff.
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Condition reports whether the awaited state has been reached. A non nil error stops the polling.
+type Condition func(ctx context.Context) (done bool, err error)
+
+// Backoff defines the delay between two attempts: it starts from Initial and is multiplied by
+// Multiplier after each attempt up to Max. Jitter randomizes each delay by up to the given fraction.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff is the backoff used when none is provided.
+var DefaultBackoff = Backoff{
+	Initial:    2 * time.Second,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Attempt describes a failed attempt and is passed to the progress callback.
+type Attempt struct {
+	Number  int
+	Elapsed time.Duration
+	Next    time.Duration
+}
+
+// Options configures a Poll.
+type Options struct {
+	Backoff Backoff
+	// Timeout is the overall deadline of the polling, no deadline besides the context one when zero.
+	Timeout time.Duration
+	// OnAttempt is called after each unsuccessful attempt.
+	OnAttempt func(Attempt)
+}
+
+// TimeoutError is returned when the condition is not met before the deadline.
+type TimeoutError struct {
+	Attempts int
+	Elapsed  time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("condition not met after %d attempts in %s", e.Attempts, e.Elapsed.Round(time.Second))
+}
+
+// Poll checks the condition until it is met, the deadline expires or the context is cancelled.
+func Poll(ctx context.Context, opts Options, cond Condition) error {
+	b := opts.Backoff
+	if b.Initial <= 0 {
+		b = DefaultBackoff
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = 1
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	delay := b.Initial
+	for attempt := 1; ; attempt++ {
+		done, err := cond(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		next := jitter(delay, b.Jitter)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < next {
+			next = time.Until(deadline)
+		}
+		if opts.OnAttempt != nil {
+			opts.OnAttempt(Attempt{Number: attempt, Elapsed: time.Since(start), Next: next})
+		}
+
+		t := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return TimeoutError{Attempts: attempt, Elapsed: time.Since(start)}
+			}
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		delay = time.Duration(float64(delay) * b.Multiplier)
+		if b.Max > 0 && delay > b.Max {
+			delay = b.Max
+		}
+	}
+}
+
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	// nolint:gosec // jitter does not need a cryptographically secure source
+	return d + time.Duration(fraction*float64(d)*(2*rand.Float64()-1))
+}
@@ -0,0 +1,69 @@
+package wait_test
+
+import (
+	"caravan-cli/wait"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var fast = wait.Backoff{Initial: time.Millisecond, Max: 4 * time.Millisecond, Multiplier: 2, Jitter: 0.1}
+
+func TestPoll(t *testing.T) {
+	ctx := context.Background()
+	attempts := []wait.Attempt{}
+	calls := 0
+	err := wait.Poll(ctx, wait.Options{
+		Backoff:   fast,
+		Timeout:   time.Second,
+		OnAttempt: func(a wait.Attempt) { attempts = append(attempts, a) },
+	}, func(ctx context.Context) (bool, error) {
+		calls++
+		return calls == 4, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 4 || len(attempts) != 3 {
+		t.Errorf("got %d calls and %d callbacks but wanted 4 and 3", calls, len(attempts))
+	}
+	for i, a := range attempts {
+		if a.Number != i+1 {
+			t.Errorf("got attempt %d but wanted %d", a.Number, i+1)
+		}
+		if a.Next > 5*time.Millisecond {
+			t.Errorf("delay %s exceeds the maximum backoff", a.Next)
+		}
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	err := wait.Poll(context.Background(), wait.Options{Backoff: fast, Timeout: 20 * time.Millisecond}, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	if !errors.As(err, &wait.TimeoutError{}) {
+		t.Errorf("got %v but wanted a timeout error", err)
+	}
+}
+
+func TestPollCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := wait.Poll(ctx, wait.Options{Backoff: wait.Backoff{Initial: time.Hour}}, func(ctx context.Context) (bool, error) {
+		cancel()
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v but wanted %v", err, context.Canceled)
+	}
+}
+
+func TestPollError(t *testing.T) {
+	boom := errors.New("boom")
+	err := wait.Poll(context.Background(), wait.Options{Backoff: fast}, func(ctx context.Context) (bool, error) {
+		return false, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("got %v but wanted %v", err, boom)
+	}
+}